@@ -72,7 +72,14 @@ private function loadProxies(): array
 
         // Try to connect to proxy service (if available)
         try {
-            $response = $this->client->get('http://localhost:8080/proxies', [
+            $headers = [];
+            if ($apiKey = config('scraping.proxy_service.api_key')) {
+                $headers['X-API-Key'] = $apiKey;
+            }
+
+            $response = $this->client->get(config('scraping.proxy_service.url', 'http://localhost:8080') . '/proxies', [
+                'query' => ['limit' => 500, 'reveal' => 'true'],
+                'headers' => $headers,
                 'timeout' => 5,
                 'connect_timeout' => 3,
             ]);
@@ -80,7 +87,17 @@ private function loadProxies(): array
             if ($response->getStatusCode() === 200) {
                 $data = json_decode($response->getBody(), true);
                 $servicProxies = $data['proxies'] ?? [];
-                $proxies = array_merge($proxies, $servicProxies);
+
+                // Entries are objects with url/healthy fields; skip the unhealthy ones
+                foreach ($servicProxies as $servicProxy) {
+                    if (is_array($servicProxy)) {
+                        if (($servicProxy['healthy'] ?? true) && isset($servicProxy['url'])) {
+                            $proxies[] = $servicProxy['url'];
+                        }
+                    } else {
+                        $proxies[] = $servicProxy;
+                    }
+                }
             }
         } catch (RequestException $e) {
             Log::debug('Proxy service unavailable: ' . $e->getMessage());
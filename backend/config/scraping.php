@@ -30,6 +30,20 @@
         // 'https://your-proxy-server:8080',
     ],
 
+    /*
+    |--------------------------------------------------------------------------
+    | Proxy Service
+    |--------------------------------------------------------------------------
+    |
+    | The Go proxy service masks proxy credentials unless the request carries
+    | its API key, so set the key here to receive usable proxies
+    |
+    */
+    'proxy_service' => [
+        'url' => env('PROXY_SERVICE_URL', 'http://localhost:8080'),
+        'api_key' => env('PROXY_SERVICE_API_KEY'),
+    ],
+
     /*
     |--------------------------------------------------------------------------
     | User Agents
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context key set when the request carried a valid X-API-Key, or when
+// authentication is disabled
+const authenticatedKey = "authenticated"
+
+// Paths that never require a key so probes keep working
+var authExemptPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// Writes that only hand back what a read took, so anyone allowed to read may
+// make them
+var readReleasePaths = map[string]bool{
+	"/proxy/release": true,
+}
+
+// Middleware requiring X-API-Key to match key on writes, and on reads too
+// when protectReads is set. Releasing a checkout counts as a read. An empty
+// key disables authentication.
+func apiKeyMiddleware(key string, protectReads bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key == "" {
+			c.Set(authenticatedKey, true)
+			c.Next()
+			return
+		}
+
+		valid := subtle.ConstantTimeCompare([]byte(c.GetHeader("X-API-Key")), []byte(key)) == 1
+		c.Set(authenticatedKey, valid)
+
+		if valid || authExemptPaths[c.Request.URL.Path] || (!protectReads && (isRead(c.Request.Method) || readReleasePaths[c.Request.URL.Path])) {
+			c.Next()
+			return
+		}
+
+		respondError(c, http.StatusUnauthorized, errUnauthorized, "Missing or invalid API key")
+	}
+}
+
+// Whether the request was authenticated by apiKeyMiddleware
+func isAuthenticated(c *gin.Context) bool {
+	return c.GetBool(authenticatedKey)
+}
+
+// Whether the caller asked for unmasked credentials with ?reveal=true.
+// Revealing requires an authenticated request.
+func revealRequested(c *gin.Context) (bool, error) {
+	if c.Query("reveal") != "true" {
+		return false, nil
+	}
+	if !isAuthenticated(c) {
+		return false, errors.New("reveal: a valid API key is required to reveal credentials")
+	}
+	return true, nil
+}
+
+// Methods that do not change the pool
+func isRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Largest request body accepted unless MAX_BODY_BYTES says otherwise
+const defaultMaxBodyBytes = 1 << 20
+
+// Middleware capping request bodies at limit bytes. A body declared larger
+// is refused with 413 straight away; one that turns out larger fails to
+// decode in bindJSON, which also responds 413.
+func bodyLimitMiddleware(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			respondError(c, http.StatusRequestEntityTooLarge, errBodyTooLarge, bodyTooLargeMessage(limit))
+			return
+		}
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+		c.Next()
+	}
+}
+
+func bodyTooLargeMessage(limit int64) string {
+	return fmt.Sprintf("Request body must not exceed %d bytes", limit)
+}
+
+// Decode the JSON body into req, rejecting fields req does not have, and
+// validate its binding tags. It responds 413 if the body is over the size
+// limit, 400 naming the field if one is unknown, and 400 with usage for any
+// other problem, including anything after the first JSON value, and reports
+// whether req was bound.
+func bindJSON(c *gin.Context, req any, usage string) bool {
+	dec := json.NewDecoder(c.Request.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(req)
+	if err == nil {
+		err = trailingData(dec)
+	}
+	if err == nil {
+		err = binding.Validator.ValidateStruct(req)
+	}
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		respondError(c, http.StatusRequestEntityTooLarge, errBodyTooLarge, bodyTooLargeMessage(tooLarge.Limit))
+	case unknownField(err) != "":
+		field := unknownField(err)
+		body := errorBody(c, errInvalidRequest, "Unknown field "+strconv.Quote(field)+". "+usage)
+		body["field"] = field
+		c.AbortWithStatusJSON(http.StatusBadRequest, body)
+	default:
+		respondError(c, http.StatusBadRequest, errInvalidRequest, usage)
+	}
+	return false
+}
+
+var errTrailingData = errors.New("request body holds more than one JSON value")
+
+// Check that dec has nothing left but whitespace. A body over the size limit
+// keeps its MaxBytesError so bindJSON still responds 413.
+func trailingData(dec *json.Decoder) error {
+	err := dec.Decode(&struct{}{})
+	if err == io.EOF {
+		return nil
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return errTrailingData
+}
+
+// The field named by a DisallowUnknownFields decode error, or "". The json
+// package has no error type for these, only the message.
+func unknownField(err error) string {
+	field, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return ""
+	}
+	if unquoted, err := strconv.Unquote(field); err == nil {
+		return unquoted
+	}
+	return field
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOversizedBodyIsRejected(t *testing.T) {
+	useStore(t)
+	router := testRouter(t, routerConfig{MaxBodyBytes: 64})
+	body := `{"proxies": ["http://` + strings.Repeat("a", 100) + `.example.com:8080"]}`
+
+	declared := httptest.NewRequest(http.MethodPost, "/proxies/bulk", strings.NewReader(body))
+	// Without a declared length the limit is only hit while decoding
+	streamed := httptest.NewRequest(http.MethodPost, "/proxies/bulk", strings.NewReader(body))
+	streamed.ContentLength = -1
+
+	for name, req := range map[string]*http.Request{"declared": declared, "streamed": streamed} {
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status %d, want 413; body %s", name, w.Code, w.Body)
+			continue
+		}
+		var resp struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if resp.Error.Code != errBodyTooLarge || resp.Error.Message != bodyTooLargeMessage(64) {
+			t.Errorf("%s: error %+v, want %s", name, resp.Error, errBodyTooLarge)
+		}
+	}
+	if n := store.Len(); n != 0 {
+		t.Errorf("%d proxies added from an oversized body", n)
+	}
+}
+
+func TestUnknownFieldIsRejected(t *testing.T) {
+	useStore(t)
+	router := testRouter(t, routerConfig{})
+
+	w := serve(router, http.MethodPost, "/proxies", `{"proxy": "http://a.example.com:8080", "wieght": 3}`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want 400; body %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+		Field string `json:"field"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error.Code != errInvalidRequest || resp.Field != "wieght" || !strings.Contains(resp.Error.Message, `"wieght"`) {
+		t.Errorf("response %s, want invalid_request naming the field", w.Body)
+	}
+	if n := store.Len(); n != 0 {
+		t.Errorf("%d proxies added despite the unknown field", n)
+	}
+
+	// A second value is rejected even if the first is valid, rather than
+	// being mistaken for an unknown field
+	for _, body := range []string{`{"proxy": "http://a.example.com:8080"}{"x": 1}`, `{"proxy": "http://a.example.com:8080"} 1`} {
+		w := serve(router, http.MethodPost, "/proxies", body)
+		if w.Code != http.StatusBadRequest || strings.Contains(w.Body.String(), `"field"`) {
+			t.Errorf("body %s: status %d, body %s; want 400 invalid_request", body, w.Code, w.Body)
+		}
+	}
+	if n := store.Len(); n != 0 {
+		t.Errorf("%d proxies added from a body with trailing data", n)
+	}
+
+	// Known fields alone are accepted
+	if w := serve(router, http.MethodPost, "/proxies", `{"proxy": "http://a.example.com:8080", "weight": 3}`); w.Code != http.StatusCreated {
+		t.Errorf("valid body: status %d, body %s", w.Code, w.Body)
+	}
+}
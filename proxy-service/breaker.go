@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// States of a proxy's circuit breaker
+const (
+	// Normal operation, failures are being counted
+	breakerClosed = "closed"
+	// Too many failures, the proxy is held back until the open timeout ends
+	breakerOpen = "open"
+	// The open timeout has ended and one trial selection is allowed
+	breakerHalfOpen = "half_open"
+)
+
+// BreakerPolicy decides when a proxy's circuit opens and for how long
+type BreakerPolicy struct {
+	// Consecutive failures, from reports or health checks, that open the circuit
+	Threshold int
+	// How long the circuit first stays open
+	OpenTimeout time.Duration
+	// Cap on the open timeout, which doubles after each failed trial
+	MaxOpenTimeout time.Duration
+}
+
+// Breaker policy used until SetBreakerPolicy is called
+var defaultBreakerPolicy = BreakerPolicy{
+	Threshold:      5,
+	OpenTimeout:    30 * time.Second,
+	MaxOpenTimeout: 10 * time.Minute,
+}
+
+// Per-proxy circuit breaker. It has its own lock because selections claim
+// the half-open trial while holding only the store's read lock.
+type breaker struct {
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openUntil time.Time
+	// Open timeout used the last time the circuit opened
+	timeout time.Duration
+	// Whether the half-open trial has been handed out and awaits an outcome
+	trialPending bool
+}
+
+func newBreaker() *breaker {
+	return &breaker{state: breakerClosed}
+}
+
+// Move an open circuit whose timeout has ended to half-open; callers must
+// hold b.mu
+func (b *breaker) advance(now time.Time) {
+	if b.state == breakerOpen && !now.Before(b.openUntil) {
+		b.state = breakerHalfOpen
+		b.trialPending = false
+	}
+}
+
+// State returns the breaker's state at now
+func (b *breaker) State(now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	return b.state
+}
+
+// Blocked reports whether the breaker keeps the proxy from being selected at
+// now, and until when if that is known. A half-open circuit blocks once its
+// trial is out, until the trial's outcome is recorded.
+func (b *breaker) Blocked(now time.Time) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	switch {
+	case b.state == breakerOpen:
+		return b.openUntil, true
+	case b.state == breakerHalfOpen && b.trialPending:
+		return time.Time{}, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// Note that the proxy was handed out, claiming the trial if half-open
+func (b *breaker) selected(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	if b.state == breakerHalfOpen {
+		b.trialPending = true
+	}
+}
+
+// Record the outcome of using or checking the proxy. Enough consecutive
+// failures open a closed circuit. In half-open a success closes it and a
+// failure opens it again for twice as long. Outcomes arriving while it is
+// open are ignored.
+func (b *breaker) record(ok bool, now time.Time, policy BreakerPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advance(now)
+	switch b.state {
+	case breakerClosed:
+		if ok {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= policy.Threshold {
+			b.open(now, policy.OpenTimeout)
+		}
+	case breakerHalfOpen:
+		if ok {
+			b.state = breakerClosed
+			b.failures = 0
+			b.timeout = 0
+			b.trialPending = false
+			return
+		}
+		timeout := 2 * b.timeout
+		if timeout > policy.MaxOpenTimeout {
+			timeout = policy.MaxOpenTimeout
+		}
+		b.open(now, timeout)
+	}
+}
+
+// Open the circuit for timeout; callers must hold b.mu
+func (b *breaker) open(now time.Time, timeout time.Duration) {
+	b.state = breakerOpen
+	b.timeout = timeout
+	b.openUntil = now.Add(timeout)
+	b.trialPending = false
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+var testBreakerPolicy = BreakerPolicy{Threshold: 3, OpenTimeout: time.Second, MaxOpenTimeout: 5 * time.Second}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	b := newBreaker()
+	now := time.Now()
+
+	for i := 1; i < testBreakerPolicy.Threshold; i++ {
+		b.record(false, now, testBreakerPolicy)
+		if got := b.State(now); got != breakerClosed {
+			t.Fatalf("after %d failures state = %s, want %s", i, got, breakerClosed)
+		}
+	}
+	b.record(false, now, testBreakerPolicy)
+	if got := b.State(now); got != breakerOpen {
+		t.Fatalf("at the threshold state = %s, want %s", got, breakerOpen)
+	}
+	if until, blocked := b.Blocked(now); !blocked || !until.Equal(now.Add(time.Second)) {
+		t.Fatalf("open circuit Blocked = %v, %v; want blocked until %v", until, blocked, now.Add(time.Second))
+	}
+	// Outcomes arriving while open change nothing
+	b.record(true, now, testBreakerPolicy)
+	if got := b.State(now); got != breakerOpen {
+		t.Fatalf("success while open moved state to %s", got)
+	}
+
+	now = now.Add(time.Second)
+	if got := b.State(now); got != breakerHalfOpen {
+		t.Fatalf("after the open timeout state = %s, want %s", got, breakerHalfOpen)
+	}
+	if _, blocked := b.Blocked(now); blocked {
+		t.Fatal("half-open circuit blocks before its trial is handed out")
+	}
+	b.selected(now)
+	if _, blocked := b.Blocked(now); !blocked {
+		t.Fatal("half-open circuit hands out a second trial")
+	}
+
+	b.record(true, now, testBreakerPolicy)
+	if got := b.State(now); got != breakerClosed {
+		t.Fatalf("after a successful trial state = %s, want %s", got, breakerClosed)
+	}
+	if _, blocked := b.Blocked(now); blocked {
+		t.Fatal("closed circuit blocks")
+	}
+}
+
+func TestBreakerSuccessResetsFailureStreak(t *testing.T) {
+	b := newBreaker()
+	now := time.Now()
+	for round := 0; round < 3; round++ {
+		for i := 1; i < testBreakerPolicy.Threshold; i++ {
+			b.record(false, now, testBreakerPolicy)
+		}
+		b.record(true, now, testBreakerPolicy)
+	}
+	if got := b.State(now); got != breakerClosed {
+		t.Fatalf("interrupted failure streaks left state %s, want %s", got, breakerClosed)
+	}
+}
+
+func TestBreakerFailedTrialDoublesTimeout(t *testing.T) {
+	b := newBreaker()
+	now := time.Now()
+	for i := 0; i < testBreakerPolicy.Threshold; i++ {
+		b.record(false, now, testBreakerPolicy)
+	}
+
+	for _, want := range []time.Duration{2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		now = now.Add(b.timeout)
+		if got := b.State(now); got != breakerHalfOpen {
+			t.Fatalf("after the open timeout state = %s, want %s", got, breakerHalfOpen)
+		}
+		b.selected(now)
+		b.record(false, now, testBreakerPolicy)
+		if got := b.State(now); got != breakerOpen {
+			t.Fatalf("after a failed trial state = %s, want %s", got, breakerOpen)
+		}
+		if until, _ := b.Blocked(now); !until.Equal(now.Add(want)) {
+			t.Fatalf("reopened until %v, want %v", until.Sub(now), want)
+		}
+		if got := b.State(now.Add(want - time.Millisecond)); got != breakerOpen {
+			t.Fatalf("circuit left open state early: %s", got)
+		}
+	}
+}
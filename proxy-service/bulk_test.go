@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestBulkImportOfExportedListFindsDuplicates(t *testing.T) {
+	useStore(t, "http://u:p@a.example.com:80", "socks5://b.example.com:1080", "http://c.example.com:3128")
+	router := testRouter(t, routerConfig{})
+
+	w := serve(router, http.MethodGet, "/proxies/export?format=txt&reveal=true", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: status %d", w.Code)
+	}
+	exported := strings.Fields(w.Body.String())
+	payload, _ := json.Marshal(bulkRequest{Proxies: exported})
+
+	w = serve(router, http.MethodPost, "/proxies/bulk", string(payload))
+	if w.Code != http.StatusOK {
+		t.Fatalf("bulk: status %d, body %s", w.Code, w.Body)
+	}
+	var body struct {
+		Results []bulkResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Results) != len(exported) {
+		t.Fatalf("got %d results for %d proxies", len(body.Results), len(exported))
+	}
+	for _, r := range body.Results {
+		if r.Status != bulkDuplicate {
+			t.Errorf("%s: status %q (%s), want %q", r.Input, r.Status, r.Reason, bulkDuplicate)
+		}
+	}
+}
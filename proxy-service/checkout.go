@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// CheckoutStore gives each checkout made through the API an ID, so the
+// caller can hand it back with POST /proxy/release without knowing the
+// proxy's unmasked URL. Checkouts are leased: one not released within the
+// TTL is released for the caller, so abandoned checkouts cannot hold a
+// proxy's connection slots forever.
+type CheckoutStore struct {
+	mu     sync.Mutex
+	store  *ProxyStore
+	ttl    time.Duration
+	leases map[string]checkoutLease
+}
+
+type checkoutLease struct {
+	url       string
+	expiresAt time.Time
+}
+
+// NewCheckoutStore creates a checkout store releasing proxies into store,
+// with leases lasting ttl
+func NewCheckoutStore(store *ProxyStore, ttl time.Duration) *CheckoutStore {
+	return &CheckoutStore{
+		store:  store,
+		ttl:    ttl,
+		leases: make(map[string]checkoutLease),
+	}
+}
+
+// Lease records a checkout of the proxy at url, which must already hold one
+// of its connection slots, and returns the ID to release it with and when
+// the lease expires
+func (cs *CheckoutStore) Lease(url string, now time.Time) (string, time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	id := newRequestID()
+	lease := checkoutLease{url: url, expiresAt: now.Add(cs.ttl)}
+	cs.leases[id] = lease
+	return id, lease.expiresAt
+}
+
+// Release hands back the checkout with the given ID and returns the proxy's
+// URL and remaining active count. found is false if there is no such
+// checkout or its lease expired before now; ok is false if the proxy has
+// since left the pool and its slot went with it.
+func (cs *CheckoutStore) Release(id string, now time.Time) (url string, remaining int64, found, ok bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	lease, found := cs.leases[id]
+	if !found {
+		return "", 0, false, false
+	}
+	delete(cs.leases, id)
+	remaining, inPool, released := cs.store.Release(lease.url)
+	if !now.Before(lease.expiresAt) {
+		// Not yet swept by Run; the slot is freed all the same
+		return "", 0, false, false
+	}
+	return lease.url, remaining, true, inPool && released
+}
+
+// ReleaseURL hands back one checkout of the proxy at url, with the same
+// results as ProxyStore.Release, and forgets the lease expiring soonest so
+// that its ID can no longer release it a second time
+func (cs *CheckoutStore) ReleaseURL(url string) (remaining int64, found, ok bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	remaining, found, ok = cs.store.Release(url)
+	if !ok {
+		return remaining, found, ok
+	}
+	var soonest string
+	for id, lease := range cs.leases {
+		if lease.url == url && (soonest == "" || lease.expiresAt.Before(cs.leases[soonest].expiresAt)) {
+			soonest = id
+		}
+	}
+	delete(cs.leases, soonest)
+	return remaining, found, ok
+}
+
+// Run releases expired checkouts periodically until ctx is done
+func (cs *CheckoutStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(min(cs.ttl, time.Minute))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			cs.expire(now)
+		}
+	}
+}
+
+// Release the checkouts whose lease expired before now
+func (cs *CheckoutStore) expire(now time.Time) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for id, lease := range cs.leases {
+		if now.Before(lease.expiresAt) {
+			continue
+		}
+		delete(cs.leases, id)
+		cs.store.Release(lease.url)
+		slog.Warn("Released expired checkout", "proxy", maskCredentials(lease.url), "expired_at", lease.expiresAt)
+	}
+}
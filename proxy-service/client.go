@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Redirects a proxied test request may follow, all on the original host
+const maxTestRedirects = 3
+
+// Timeouts for the connection phases of a proxied request. Callers bound the
+// request as a whole with client.Timeout or a context deadline.
+const (
+	proxyDialTimeout         = 10 * time.Second
+	proxyTLSHandshakeTimeout = 10 * time.Second
+	proxyIdleConnTimeout     = 90 * time.Second
+)
+
+// buildClient returns an HTTP client that sends every request through the
+// proxy at proxyURL. http and https proxies go through the transport's Proxy
+// hook; socks5 proxies, which http.Transport cannot speak, replace its dialer
+// with a SOCKS5 one. The client never follows redirects off the requested host.
+func buildClient(proxyURL string) (*http.Client, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %v", err)
+	}
+
+	dialer := &net.Dialer{Timeout: proxyDialTimeout}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: proxyTLSHandshakeTimeout,
+		IdleConnTimeout:     proxyIdleConnTimeout,
+	}
+
+	switch u.Scheme {
+	case "http", "https":
+		transport.Proxy = http.ProxyURL(u)
+	case "socks5":
+		contextDialer, err := socks5Dialer(u, dialer)
+		if err != nil {
+			return nil, err
+		}
+		transport.DialContext = contextDialer.DialContext
+	default:
+		return nil, fmt.Errorf("scheme: unsupported %q", u.Scheme)
+	}
+
+	return &http.Client{
+		Transport:     transport,
+		CheckRedirect: sameHostRedirects,
+	}, nil
+}
+
+// Build a dialer that opens connections through the SOCKS5 proxy at u,
+// authenticating with its credentials if it has any
+func socks5Dialer(u *url.URL, forward proxy.Dialer) (proxy.ContextDialer, error) {
+	var auth *proxy.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &proxy.Auth{User: u.User.Username(), Password: password}
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPorts["socks5"])
+	}
+
+	socks, err := proxy.SOCKS5("tcp", host, auth, forward)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: %v", err)
+	}
+	contextDialer, ok := socks.(proxy.ContextDialer)
+	if !ok {
+		return nil, errors.New("proxy: socks5 dialer does not support contexts")
+	}
+	return contextDialer, nil
+}
+
+// Follow a few redirects on the original host, stopping at the redirect
+// response for anything else
+func sameHostRedirects(req *http.Request, via []*http.Request) error {
+	if len(via) > maxTestRedirects || req.URL.Host != via[0].URL.Host {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
+
+// Outcome of sending a request through a proxy
+type testResult struct {
+	// Pool proxy used, without credentials; empty when the caller named one
+	Proxy     string  `json:"proxy,omitempty"`
+	OK        bool    `json:"ok"`
+	Status    int     `json:"status,omitempty"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// GET target through the proxy at raw and report how it went
+func testProxy(ctx context.Context, raw, target string, timeout time.Duration) testResult {
+	client, err := buildClient(raw)
+	if err != nil {
+		return testResult{Error: err.Error()}
+	}
+	client.Timeout = timeout
+	defer client.CloseIdleConnections()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return testResult{Error: err.Error()}
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	latency := float64(time.Since(start)) / float64(time.Millisecond)
+	if err != nil {
+		return testResult{LatencyMS: latency, Error: err.Error()}
+	}
+	resp.Body.Close()
+
+	return testResult{
+		OK:        resp.StatusCode < 400,
+		Status:    resp.StatusCode,
+		LatencyMS: latency,
+	}
+}
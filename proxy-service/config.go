@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadProxies reads the proxy list from the file named by PROXY_LIST_FILE,
+// then the comma-separated PROXIES variable, falling back to the defaults.
+// Entries are normalized and duplicates dropped.
+func LoadProxies() ([]string, error) {
+	if path := os.Getenv("PROXY_LIST_FILE"); path != "" {
+		proxies, err := loadProxyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return dedupeProxies(proxies), nil
+	}
+
+	if proxies := envList("PROXIES"); len(proxies) > 0 {
+		return dedupeProxies(proxies), nil
+	}
+
+	return dedupeProxies(defaultProxies), nil
+}
+
+// Read a newline-delimited proxy file, skipping blank lines and # comments
+func loadProxyFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open proxy list: %w", err)
+	}
+	defer f.Close()
+
+	var proxies []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxies = append(proxies, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read proxy list: %w", err)
+	}
+
+	return proxies, nil
+}
+
+// Read a duration such as "30s" from the environment, using def when unset
+func envDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s: must be positive", key)
+	}
+	return d, nil
+}
+
+// Read a positive integer from the environment, using def when unset
+func envInt(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("%s: must be positive", key)
+	}
+	return n, nil
+}
+
+// Read a non-negative integer from the environment, using def when unset.
+// Used for limits where zero turns the feature off.
+func envCount(key string, def int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%s: must not be negative", key)
+	}
+	return n, nil
+}
+
+// Resolve the bind address from the --addr flag, then LISTEN_ADDR, then :8080,
+// rejecting anything that is not a host:port with a valid port
+func listenAddr(flagAddr string) (string, error) {
+	addr := flagAddr
+	if addr == "" {
+		addr = os.Getenv("LISTEN_ADDR")
+	}
+	if addr == "" {
+		addr = ":8080"
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", fmt.Errorf("listen address %q: %w", addr, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return "", fmt.Errorf("listen address %q: invalid port %q", addr, port)
+	}
+	return addr, nil
+}
+
+// Read a positive number from the environment, using def when unset
+func envFloat(key string, def float64) (float64, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	if f <= 0 {
+		return 0, fmt.Errorf("%s: must be positive", key)
+	}
+	return f, nil
+}
+
+// Read a comma-separated list from the environment, dropping empty items
+func envList(key string) []string {
+	var out []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request headers browsers may send cross-origin, including the API key
+const corsAllowHeaders = "Content-Type, X-API-Key, X-Request-ID"
+
+// Middleware answering CORS requests from the allowed origins ("*" allows
+// any). With no origins configured it adds no headers at all.
+func corsMiddleware(origins []string) gin.HandlerFunc {
+	allowed := make(map[string]bool, len(origins))
+	for _, o := range origins {
+		allowed[strings.TrimRight(o, "/")] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if len(allowed) == 0 || origin == "" || !(allowed[origin] || allowed["*"]) {
+			c.Next()
+			return
+		}
+
+		// Echo the origin rather than "*" so credentialed requests are accepted
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Allow-Credentials", "true")
+		c.Header("Access-Control-Expose-Headers", requestIDHeader)
+		c.Header("Vary", "Origin")
+
+		if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+			c.Header("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", corsAllowHeaders)
+			c.Header("Access-Control-Max-Age", "600")
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import "github.com/gin-gonic/gin"
+
+// Machine-readable codes carried in every error response
+const (
+	errInvalidRequest   = "invalid_request"
+	errInvalidProxy     = "invalid_proxy"
+	errUnauthorized     = "unauthorized"
+	errProxyNotFound    = "proxy_not_found"
+	errCheckoutNotFound = "checkout_not_found"
+	errProxyExists      = "proxy_exists"
+	errNoCheckouts      = "no_active_checkouts"
+	errNoMatch          = "no_matching_proxies"
+	errNoProxies        = "no_proxies"
+	errRateLimited      = "rate_limited"
+	errTimeout          = "timeout"
+	errForbiddenTarget  = "forbidden_target"
+	errUpstreamFailed   = "upstream_failed"
+	errRouteNotFound    = "not_found"
+	errInternal         = "internal"
+	errBodyTooLarge     = "body_too_large"
+)
+
+// Build the error envelope {"error": {"code", "message", "request_id"}}.
+// Callers may add top-level fields with further detail before sending it.
+func errorBody(c *gin.Context, code, message string) gin.H {
+	return gin.H{"error": gin.H{
+		"code":       code,
+		"message":    message,
+		"request_id": requestID(c),
+	}}
+}
+
+// Respond with the error envelope and stop any remaining handlers
+func respondError(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, errorBody(c, code, message))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestErrorEnvelope(t *testing.T) {
+	useStore(t, "http://a.example.com:8080")
+	router := testRouter(t, routerConfig{APIKey: "secret"})
+
+	tests := []struct {
+		name         string
+		method, path string
+		body         string
+		header       []string
+		status       int
+		code         string
+		// Top-level fields besides error
+		extra string
+	}{
+		{"unknown route", http.MethodGet, "/nowhere", "", nil, http.StatusNotFound, errRouteNotFound, ""},
+		{"missing key", http.MethodPost, "/proxies", `{"proxy": "http://b.example.com:8080"}`, nil, http.StatusUnauthorized, errUnauthorized, ""},
+		{"malformed body", http.MethodPost, "/proxies", `{"proxy":`, []string{"X-API-Key", "secret"}, http.StatusBadRequest, errInvalidRequest, ""},
+		{"unknown proxy", http.MethodDelete, "/proxies", `{"proxy": "http://b.example.com:8080"}`, []string{"X-API-Key", "secret"}, http.StatusNotFound, errProxyNotFound, ""},
+		{"duplicate proxy", http.MethodPost, "/proxies", `{"proxy": "http://a.example.com:8080"}`, []string{"X-API-Key", "secret"}, http.StatusConflict, errProxyExists, "proxy"},
+		{"bad filter", http.MethodGet, "/proxy?scheme=ftp", "", nil, http.StatusBadRequest, errInvalidRequest, ""},
+	}
+	for _, tt := range tests {
+		w := serve(router, tt.method, tt.path, tt.body, tt.header...)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d; body %s", tt.name, w.Code, tt.status, w.Body)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+			t.Errorf("%s: Content-Type %q, want JSON", tt.name, ct)
+		}
+
+		var body map[string]json.RawMessage
+		var envelope map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: body %s is not a JSON object: %v", tt.name, w.Body, err)
+			continue
+		}
+		if err := json.Unmarshal(body["error"], &envelope); err != nil {
+			t.Errorf("%s: body %s has no error object: %v", tt.name, w.Body, err)
+			continue
+		}
+		delete(body, "error")
+		if got := strings.Join(keys(body), ","); got != tt.extra {
+			t.Errorf("%s: top-level fields besides error %q, want %q", tt.name, got, tt.extra)
+		}
+		if got := strings.Join(keys(envelope), ","); got != "code,message,request_id" {
+			t.Errorf("%s: error fields %s, want code,message,request_id", tt.name, got)
+		}
+		if envelope["code"] != tt.code {
+			t.Errorf("%s: code %v, want %s", tt.name, envelope["code"], tt.code)
+		}
+		if msg, _ := envelope["message"].(string); msg == "" {
+			t.Errorf("%s: empty message", tt.name)
+		}
+		if id := w.Header().Get(requestIDHeader); id == "" || envelope["request_id"] != id {
+			t.Errorf("%s: request_id %v, want the %s header %q", tt.name, envelope["request_id"], requestIDHeader, id)
+		}
+	}
+}
+
+func TestErrorEnvelopeEchoesRequestID(t *testing.T) {
+	router := testRouter(t, routerConfig{})
+	w := serve(router, http.MethodGet, "/nowhere", "", requestIDHeader, "trace-123")
+
+	var body struct {
+		Error struct {
+			RequestID string `json:"request_id"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.RequestID != "trace-123" {
+		t.Errorf("request_id = %q, want the client's trace-123", body.Error.RequestID)
+	}
+}
+
+// Sorted keys of m
+func keys[V any](m map[string]V) []string {
+	out := make([]string, 0, len(m))
+	for k := range m {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
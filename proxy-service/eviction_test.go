@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportEvictsAfterThreshold(t *testing.T) {
+	const bad, good = "http://a.example.com:8080", "http://b.example.com:8080"
+	s := useStore(t, bad, good)
+	s.SetEvictionThreshold(3)
+	router := testRouter(t, routerConfig{})
+
+	report := `{"proxy": "` + bad + `", "ok": false}`
+	for i := 1; i <= 3; i++ {
+		w := serve(router, http.MethodPost, "/proxy/report", report)
+		if w.Code != http.StatusOK {
+			t.Fatalf("report %d: status %d, body %s", i, w.Code, w.Body)
+		}
+		var p Proxy
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Evicted != (i == 3) || p.TotalFailures != i {
+			t.Fatalf("report %d: evicted %v after %d failures", i, p.Evicted, p.TotalFailures)
+		}
+	}
+
+	w := serve(router, http.MethodGet, "/proxies", "")
+	if strings.Contains(w.Body.String(), "a.example.com") || !strings.Contains(w.Body.String(), "b.example.com") {
+		t.Errorf("/proxies after eviction = %s, want only %s", w.Body, good)
+	}
+	if w := serve(router, http.MethodPost, "/proxy/report", report); w.Code != http.StatusNotFound {
+		t.Errorf("report on an evicted proxy = %d, want 404", w.Code)
+	}
+}
+
+func TestHealthCheckEvictsAfterThreshold(t *testing.T) {
+	const url = "http://a.example.com:8080"
+	s := useStore(t, url)
+	s.SetEvictionThreshold(2)
+
+	if s.SetHealth(url, false, 0, time.Now()) {
+		t.Fatal("evicted after the first failed check")
+	}
+	// A passing check does not reset the lifetime failure count
+	s.SetHealth(url, true, time.Millisecond, time.Now())
+	if !s.SetHealth(url, false, 0, time.Now()) {
+		t.Fatal("not evicted at the threshold")
+	}
+	if n := s.Len(); n != 0 {
+		t.Errorf("%d proxies left after eviction, want 0", n)
+	}
+}
+
+func TestEvictionDisabled(t *testing.T) {
+	const url = "http://a.example.com:8080"
+	s := useStore(t, url)
+	for i := 0; i < 50; i++ {
+		if p, _ := s.Report(url, false, time.Now()); p.Evicted {
+			t.Fatalf("evicted after %d failures with eviction disabled", i+1)
+		}
+	}
+	if n := s.Len(); n != 1 {
+		t.Errorf("%d proxies left, want 1", n)
+	}
+}
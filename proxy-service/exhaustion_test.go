@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Fields of a 503 response from respondUnavailable
+type unavailableBody struct {
+	Error struct {
+		Code string `json:"code"`
+	} `json:"error"`
+	Reason  string     `json:"reason"`
+	RetryAt *time.Time `json:"retry_at"`
+}
+
+func getUnavailable(t *testing.T) (unavailableBody, http.Header) {
+	t.Helper()
+
+	w := serve(testRouter(t, routerConfig{}), http.MethodGet, "/proxy", "")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("GET /proxy = %d %s, want 503", w.Code, w.Body)
+	}
+	var body unavailableBody
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != errNoProxies {
+		t.Errorf("error code = %q, want %q", body.Error.Code, errNoProxies)
+	}
+	return body, w.Header()
+}
+
+func TestUnavailableEmptyPool(t *testing.T) {
+	s := useStore(t)
+	if ex := s.Exhaustion(nil, time.Now()); ex.Reason != exhaustedEmpty || !ex.RetryAt.IsZero() {
+		t.Errorf("Exhaustion = %+v, want %s with no retry time", ex, exhaustedEmpty)
+	}
+
+	body, header := getUnavailable(t)
+	if body.Reason != exhaustedEmpty {
+		t.Errorf("reason = %q, want %q", body.Reason, exhaustedEmpty)
+	}
+	if body.RetryAt != nil || header.Get("Retry-After") != "" {
+		t.Errorf("empty pool suggests a retry: retry_at %v, Retry-After %q", body.RetryAt, header.Get("Retry-After"))
+	}
+}
+
+func TestUnavailableAllCoolingDown(t *testing.T) {
+	s := useStore(t, "http://a.example.com:8080", "http://b.example.com:8080")
+	s.SetCooldownPolicy(CooldownPolicy{Threshold: 1, Duration: 90 * time.Second})
+	s.SetBreakerPolicy(BreakerPolicy{Threshold: 100, OpenTimeout: time.Minute, MaxOpenTimeout: time.Minute})
+	now := time.Now()
+	s.Report("http://a.example.com:8080", false, now)
+	// The second proxy cools down for longer, so the first sets the retry time
+	s.Report("http://b.example.com:8080", false, now.Add(30*time.Second))
+
+	ex := s.Exhaustion(nil, now)
+	if ex.Reason != exhaustedCooldown || !ex.RetryAt.Equal(now.Add(90*time.Second)) {
+		t.Errorf("Exhaustion = %+v, want %s until %v", ex, exhaustedCooldown, now.Add(90*time.Second))
+	}
+
+	body, header := getUnavailable(t)
+	if body.Reason != exhaustedCooldown {
+		t.Errorf("reason = %q, want %q", body.Reason, exhaustedCooldown)
+	}
+	if body.RetryAt == nil || !body.RetryAt.Equal(now.Add(90*time.Second)) {
+		t.Errorf("retry_at = %v, want %v", body.RetryAt, now.Add(90*time.Second))
+	}
+	retryAfter, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || retryAfter < 89 || retryAfter > 90 {
+		t.Errorf("Retry-After = %q, want about 90 seconds", header.Get("Retry-After"))
+	}
+}
+
+func TestUnavailableUnhealthyWithoutNextCheck(t *testing.T) {
+	s := useStore(t, "http://a.example.com:8080", "http://b.example.com:8080")
+	s.SetCooldownPolicy(CooldownPolicy{Threshold: 1, Duration: 90 * time.Second})
+	s.SetBreakerPolicy(BreakerPolicy{Threshold: 1, OpenTimeout: 45 * time.Second, MaxOpenTimeout: time.Minute})
+	now := time.Now()
+	// a cools down for 90s and its circuit opens for 45s; b only has the circuit
+	s.Report("http://a.example.com:8080", false, now)
+	s.proxies[1].breaker.record(false, now, s.breaker)
+	for _, p := range s.proxies {
+		p.Healthy = false
+	}
+
+	ex := s.Exhaustion(nil, now)
+	if ex.Reason != exhaustedUnhealthy || !ex.RetryAt.Equal(now.Add(45*time.Second)) {
+		t.Errorf("Exhaustion = %+v, want %s until %v", ex, exhaustedUnhealthy, now.Add(45*time.Second))
+	}
+	body, header := getUnavailable(t)
+	if body.Reason != exhaustedUnhealthy || body.RetryAt == nil {
+		t.Errorf("reason %q, retry_at %v; want %s with a retry time", body.Reason, body.RetryAt, exhaustedUnhealthy)
+	}
+	if retryAfter, err := strconv.Atoi(header.Get("Retry-After")); err != nil || retryAfter < 44 || retryAfter > 45 {
+		t.Errorf("Retry-After = %q, want about 45 seconds", header.Get("Retry-After"))
+	}
+}
+
+func TestUnavailableUnhealthyWithNothingScheduled(t *testing.T) {
+	s := useStore(t, "http://a.example.com:8080")
+	s.proxies[0].Healthy = false
+
+	if ex := s.Exhaustion(nil, time.Now()); ex.Reason != exhaustedUnhealthy || !ex.RetryAt.IsZero() {
+		t.Errorf("Exhaustion = %+v, want %s with no retry time", ex, exhaustedUnhealthy)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Formats accepted by GET /proxies/export
+const (
+	exportJSON = "json"
+	exportTXT  = "txt"
+	exportCSV  = "csv"
+)
+
+// Export the whole pool, narrowed by the query filters, as ?format=json
+// (default, shaped like GET /proxies without paging), txt (one URL per line)
+// or csv (url,scheme,country,healthy). Credentials are masked unless revealed.
+func ExportProxies(c *gin.Context) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		// Also covers an empty ?format=, which DefaultQuery would keep
+		format = exportJSON
+	}
+	if format != exportJSON && format != exportTXT && format != exportCSV {
+		respondError(c, http.StatusBadRequest, errInvalidRequest, "format: unknown "+strconv.Quote(format)+", expected one of json, txt, csv")
+		return
+	}
+	filters, reveal, ok := parseSelection(c)
+	if !ok {
+		return
+	}
+
+	proxies := store.List(filters...)
+	if !reveal {
+		for i := range proxies {
+			proxies[i].URL = maskCredentials(proxies[i].URL)
+		}
+	}
+
+	switch format {
+	case exportTXT:
+		var buf bytes.Buffer
+		for _, p := range proxies {
+			buf.WriteString(p.URL)
+			buf.WriteByte('\n')
+		}
+		c.Header("Content-Disposition", `attachment; filename="proxies.txt"`)
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", buf.Bytes())
+	case exportCSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"url", "scheme", "country", "healthy"})
+		for _, p := range proxies {
+			w.Write([]string{p.URL, proxyScheme(p.URL), p.Country, strconv.FormatBool(p.Healthy)})
+		}
+		w.Flush()
+		c.Header("Content-Disposition", `attachment; filename="proxies.csv"`)
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+	default:
+		c.JSON(http.StatusOK, gin.H{"proxies": proxies, "count": len(proxies)})
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyFilter reports whether a proxy may be considered for listing or selection
+type ProxyFilter func(p *Proxy) bool
+
+// Keep only proxies accepted by every filter
+func matchAll(p *Proxy, filters []ProxyFilter) bool {
+	for _, f := range filters {
+		if !f(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// SchemeFilter matches proxies whose URL uses the given scheme
+func SchemeFilter(scheme string) ProxyFilter {
+	return func(p *Proxy) bool {
+		return proxyScheme(p.URL) == scheme
+	}
+}
+
+// TagFilter matches proxies carrying any of the given tags
+func TagFilter(tags ...string) ProxyFilter {
+	return func(p *Proxy) bool {
+		for _, want := range tags {
+			for _, have := range p.Tags {
+				if have == want {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// CountryFilter matches proxies exiting in the given country
+func CountryFilter(country string) ProxyFilter {
+	return func(p *Proxy) bool {
+		return p.Country == country
+	}
+}
+
+// URLFilter matches the proxy with exactly the given URL
+func URLFilter(url string) ProxyFilter {
+	return func(p *Proxy) bool {
+		return p.URL == url
+	}
+}
+
+// Extract the scheme of a proxy URL, or "" if it does not parse
+func proxyScheme(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme
+}
+
+// Build the filters requested through query parameters
+func queryFilters(c *gin.Context) ([]ProxyFilter, error) {
+	var filters []ProxyFilter
+
+	if scheme := c.Query("scheme"); scheme != "" {
+		if !allowedSchemes[scheme] {
+			return nil, fmt.Errorf("scheme: unsupported %q, expected one of http, https, socks5", scheme)
+		}
+		filters = append(filters, SchemeFilter(scheme))
+	}
+
+	if v := c.Query("country"); v != "" {
+		country, err := normalizeCountry(v)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, CountryFilter(country))
+	}
+
+	if tags := queryList(c, "tag"); len(tags) > 0 {
+		filters = append(filters, TagFilter(tags...))
+	}
+
+	if v := c.Query("minUptime"); v != "" {
+		minUptime, err := strconv.ParseFloat(v, 64)
+		if err != nil || minUptime < 0 || minUptime > 100 {
+			return nil, fmt.Errorf("minUptime: %q must be a percentage from 0 to 100", v)
+		}
+		filters = append(filters, UptimeFilter(minUptime, uptimeExcludeNew))
+	}
+
+	return filters, nil
+}
+
+// UptimeFilter matches proxies that passed at least minUptime percent of their
+// recent health checks. Proxies whose window is not yet full count as fully
+// up, or are left out with excludeNew.
+func UptimeFilter(minUptime float64, excludeNew bool) ProxyFilter {
+	return func(p *Proxy) bool {
+		if !p.history.full() {
+			return !excludeNew
+		}
+		uptime, _ := p.history.uptime()
+		return uptime >= minUptime
+	}
+}
+
+// Parse ?prefer= into an ordered list of supported schemes, dropping unknown
+// and repeated ones
+func queryPreference(c *gin.Context) []string {
+	seen := make(map[string]bool)
+	var schemes []string
+	for _, scheme := range queryList(c, "prefer") {
+		scheme = strings.ToLower(scheme)
+		if !allowedSchemes[scheme] || seen[scheme] {
+			continue
+		}
+		seen[scheme] = true
+		schemes = append(schemes, scheme)
+	}
+	return schemes
+}
+
+// Collect a query parameter given repeatedly and/or as a comma-separated list
+func queryList(c *gin.Context, key string) []string {
+	var out []string
+	for _, v := range c.QueryArray(key) {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTagFilterMatchesAnyTag(t *testing.T) {
+	s := useStore(t,
+		"http://a.example.com:8080",
+		"http://b.example.com:8080",
+		"http://c.example.com:8080",
+		"http://d.example.com:8080",
+	)
+	s.proxies[0].Tags = []string{"residential"}
+	s.proxies[1].Tags = []string{"datacenter", "eu-only"}
+	s.proxies[2].Tags = []string{"mobile", "residential"}
+	router := testRouter(t, routerConfig{})
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"tag=residential", []string{"a", "c"}},
+		{"tag=residential,datacenter", []string{"a", "b", "c"}},
+		{"tag=eu-only&tag=mobile", []string{"b", "c"}},
+		{"tag=residential&tag=,", []string{"a", "c"}},
+		{"tag=unknown", nil},
+	}
+	for _, tt := range tests {
+		w := serve(router, http.MethodGet, "/proxies?"+tt.query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: status %d, body %s", tt.query, w.Code, w.Body)
+		}
+		var body struct {
+			Proxies []struct {
+				URL string `json:"url"`
+			} `json:"proxies"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		var got []string
+		for _, p := range body.Proxies {
+			got = append(got, strings.TrimSuffix(strings.TrimPrefix(p.URL, "http://"), ".example.com:8080"))
+		}
+		sort.Strings(got)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestTagFilterWithoutTags(t *testing.T) {
+	if TagFilter("residential")(&Proxy{}) {
+		t.Error("untagged proxy matched a tag")
+	}
+	if TagFilter()(&Proxy{Tags: []string{"residential"}}) {
+		t.Error("an empty tag list matched")
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Redirects a forwarded request may follow
+const maxForwardRedirects = 5
+
+// Response headers that describe the upstream connection rather than the
+// content, and so are not copied back to the client
+var hopByHopHeaders = map[string]bool{
+	"Connection":          true,
+	"Keep-Alive":          true,
+	"Proxy-Authenticate":  true,
+	"Proxy-Authorization": true,
+	"Proxy-Connection":    true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Transfer-Encoding":   true,
+	"Upgrade":             true,
+}
+
+// forwardConfig controls GET /forward
+type forwardConfig struct {
+	// Limit on each attempt, including reading the response
+	Timeout time.Duration
+	// Allow targets on loopback, private and link-local addresses
+	AllowPrivate bool
+}
+
+// Handler fetching ?url= through a proxy from the pool and streaming the
+// response back. When a proxy fails to connect another is tried after a
+// backoff, as retryPolicy allows; X-Proxies-Tried says how many were used.
+func newForwardHandler(cfg forwardConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		target, err := url.Parse(c.Query("url"))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			respondError(c, http.StatusBadRequest, errInvalidRequest, "url: must be an absolute http or https URL")
+			return
+		}
+		if !cfg.AllowPrivate {
+			if err := checkPublicHost(c.Request.Context(), target.Hostname()); err != nil {
+				if timedOut(c) {
+					return
+				}
+				respondError(c, http.StatusForbidden, errForbiddenTarget, err.Error())
+				return
+			}
+		}
+
+		filters, err := queryFilters(c)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, errInvalidRequest, err.Error())
+			return
+		}
+
+		tried, err := throughPool(c, retryPolicy, filters, "proxy.forward", func(ctx context.Context, proxy Proxy, attempt int) error {
+			resp, cancel, err := forwardVia(ctx, proxy.URL, target, cfg)
+			if err != nil {
+				return err
+			}
+			defer cancel()
+			defer resp.Body.Close()
+
+			c.Header(proxiesTriedHeader, strconv.Itoa(attempt))
+			streamResponse(c, resp, proxy)
+			return nil
+		})
+		if err == nil || timedOut(c) {
+			return
+		}
+		if errors.Is(err, errNoUntriedProxy) {
+			respondUnavailable(c, filters)
+			return
+		}
+		c.Header(proxiesTriedHeader, strconv.Itoa(tried))
+		respondError(c, http.StatusBadGateway, errUpstreamFailed, "All forwarding attempts failed: "+err.Error())
+	}
+}
+
+// Send a GET for target through the proxy. On success the caller must close
+// the body and then call cancel, which also drops the client's connections.
+func forwardVia(ctx context.Context, proxyURL string, target *url.URL, cfg forwardConfig) (*http.Response, context.CancelFunc, error) {
+	client, err := buildClient(proxyURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	client.Timeout = cfg.Timeout
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxForwardRedirects {
+			return errors.New("too many redirects")
+		}
+		if cfg.AllowPrivate {
+			return nil
+		}
+		return checkPublicHost(req.Context(), req.URL.Hostname())
+	}
+
+	ctx, cancelCtx := context.WithTimeout(ctx, cfg.Timeout)
+	cancel := func() {
+		cancelCtx()
+		client.CloseIdleConnections()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return resp, cancel, nil
+}
+
+// Copy the upstream status, headers and body to the client
+func streamResponse(c *gin.Context, resp *http.Response, proxy Proxy) {
+	header := c.Writer.Header()
+	for key, values := range resp.Header {
+		if hopByHopHeaders[key] {
+			continue
+		}
+		for _, v := range values {
+			header.Add(key, v)
+		}
+	}
+	header.Set("X-Forwarded-Via", maskCredentials(proxy.URL))
+
+	c.Status(resp.StatusCode)
+	if _, err := io.Copy(c.Writer, resp.Body); err != nil {
+		slog.Warn("Forwarded response cut short", "request_id", requestID(c), "error", err)
+	}
+}
+
+// Reject hosts that are or resolve to loopback, private, link-local or
+// unspecified addresses, so the service cannot be used to reach internal
+// networks
+func checkPublicHost(ctx context.Context, host string) error {
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("url: cannot resolve %q: %v", host, err)
+	}
+	for _, ip := range ips {
+		if ip.IP.IsLoopback() || ip.IP.IsPrivate() || ip.IP.IsLinkLocalUnicast() ||
+			ip.IP.IsLinkLocalMulticast() || ip.IP.IsUnspecified() {
+			return fmt.Errorf("url: %q resolves to non-public address %s", host, ip.IP)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Ports assumed when a proxy URL does not specify one
+var defaultPorts = map[string]string{
+	"http":   "80",
+	"https":  "443",
+	"socks5": "1080",
+}
+
+// HealthChecker periodically checks every proxy and records whether it answered
+type HealthChecker struct {
+	store    *ProxyStore
+	interval time.Duration
+	timeout  time.Duration
+
+	// URL fetched through each proxy; empty to only dial the proxy over TCP
+	target string
+
+	// Clients for fetching the target, one per proxy URL, kept across rounds
+	// so their connections to the proxy are reused
+	clientsMu sync.Mutex
+	clients   map[string]*http.Client
+}
+
+// NewHealthChecker creates a checker for the given store. With a target every
+// proxy must fetch it successfully, which exercises the proxy protocol itself
+// (including SOCKS5); without one a proxy is healthy if it accepts a TCP
+// connection.
+func NewHealthChecker(store *ProxyStore, interval, timeout time.Duration, target string) *HealthChecker {
+	return &HealthChecker{
+		store:    store,
+		interval: interval,
+		timeout:  timeout,
+		target:   target,
+		clients:  make(map[string]*http.Client),
+	}
+}
+
+// Run checks the pool immediately and then on every interval until ctx is
+// done, closing the cached clients on the way out
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	defer h.closeClients(nil)
+
+	for {
+		h.CheckAll(ctx)
+		h.store.SetNextCheck(time.Now().Add(h.interval))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks every proxy in the pool concurrently, tracing the round as
+// one span with a child per proxy
+func (h *HealthChecker) CheckAll(ctx context.Context) {
+	ctx, round := tracer.Start(ctx, "health_check")
+	defer round.End()
+
+	proxies := h.store.List()
+	// Drop clients of proxies deleted or evicted since the last round
+	current := make(map[string]bool, len(proxies))
+	for _, p := range proxies {
+		current[p.URL] = true
+	}
+	h.closeClients(func(url string) bool { return !current[url] })
+
+	var wg sync.WaitGroup
+	for _, p := range proxies {
+		wg.Add(1)
+		go func(p Proxy) {
+			defer wg.Done()
+
+			checkCtx, span := startProxySpan(ctx, "proxy.health_check", p.URL)
+			start := time.Now()
+			err := h.check(checkCtx, p.URL)
+			latency := time.Since(start)
+			endSpan(span, err)
+			if ctx.Err() != nil {
+				// Shutting down; the check was cut short, not failed
+				return
+			}
+			observeHealthCheck(latency)
+			healthy := err == nil
+			if healthy != p.Healthy {
+				if healthy {
+					slog.Info("Proxy is healthy again", "proxy", maskCredentials(p.URL))
+				} else {
+					slog.Warn("Proxy is unhealthy", "proxy", maskCredentials(p.URL), "error", err)
+				}
+			}
+			if h.store.SetHealth(p.URL, healthy, latency, time.Now()) {
+				h.closeClients(func(url string) bool { return url == p.URL })
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+// Address SOCKS5 proxies are asked to CONNECT to when there is no target to
+// fetch, set from HEALTH_CHECK_SOCKS5_TARGET
+var socks5CheckTarget = "www.google.com:443"
+
+// Check the proxy by fetching the target through it. Without a target an
+// HTTP proxy only has to accept a TCP connection, while a SOCKS5 proxy must
+// complete a handshake and CONNECT to socks5CheckTarget, so a port that is
+// open but does not speak SOCKS is unhealthy.
+func (h *HealthChecker) check(ctx context.Context, raw string) error {
+	if h.target != "" {
+		return h.fetch(ctx, raw)
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+
+	dialer := &net.Dialer{Timeout: h.timeout}
+	if u.Scheme == "socks5" {
+		socks, err := socks5Dialer(u, dialer)
+		if err != nil {
+			return err
+		}
+		// The dial timeout does not cover the handshake
+		ctx, cancel := context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+
+		conn, err := socks.DialContext(ctx, "tcp", socks5CheckTarget)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), defaultPorts[u.Scheme])
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Fetch the target through the proxy, failing on transport errors and on
+// error statuses
+func (h *HealthChecker) fetch(ctx context.Context, raw string) error {
+	client, err := h.client(raw)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	// Read what is left of a short body so the connection can be reused
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("target responded %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Most of a response body read to keep a health check connection reusable;
+// longer bodies are cut off and their connection closed
+const maxDrainBytes = 64 << 10
+
+// The cached client for the proxy at raw, built on first use. Each client
+// makes one request per round, so it keeps a single idle connection, held
+// long enough to last until the next round.
+func (h *HealthChecker) client(raw string) (*http.Client, error) {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	if client, ok := h.clients[raw]; ok {
+		return client, nil
+	}
+	client, err := buildClient(raw)
+	if err != nil {
+		return nil, err
+	}
+	client.Timeout = h.timeout
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		transport.MaxIdleConns = 1
+		transport.MaxIdleConnsPerHost = 1
+		transport.IdleConnTimeout = h.interval + h.timeout
+	}
+	h.clients[raw] = client
+	return client, nil
+}
+
+// Close the idle connections of the cached clients whose proxy URL drop
+// accepts, or of all clients if drop is nil, and forget them
+func (h *HealthChecker) closeClients(drop func(url string) bool) {
+	h.clientsMu.Lock()
+	defer h.clientsMu.Unlock()
+
+	for url, client := range h.clients {
+		if drop == nil || drop(url) {
+			client.CloseIdleConnections()
+			delete(h.clients, url)
+		}
+	}
+}
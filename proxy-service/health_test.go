@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Stand in for a pool of HTTP proxies: a server answering every proxied
+// request with 204, reached through distinct proxy URLs so each gets its own
+// cached client. It counts the connections opened to it.
+func healthPool(tb testing.TB, size int) (*HealthChecker, *atomic.Int64) {
+	tb.Helper()
+
+	var conns atomic.Int64
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	tb.Cleanup(srv.Close)
+
+	urls := make([]string, size)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("http://user%d:pass@%s", i, srv.Listener.Addr())
+	}
+	h := NewHealthChecker(NewProxyStore(urls), time.Minute, 5*time.Second, "http://target.example.com/generate_204")
+	tb.Cleanup(func() { h.closeClients(nil) })
+	return h, &conns
+}
+
+func TestHealthCheckReusesConnections(t *testing.T) {
+	const size = 5
+	h, conns := healthPool(t, size)
+
+	h.CheckAll(context.Background())
+	for _, p := range h.store.List() {
+		if !p.Healthy {
+			t.Fatalf("%s unhealthy after a passing check", p.URL)
+		}
+	}
+	if n := conns.Load(); n != size {
+		t.Fatalf("first round opened %d connections, want %d", n, size)
+	}
+	h.CheckAll(context.Background())
+	if n := conns.Load(); n != size {
+		t.Errorf("second round opened %d new connections, want none", n-size)
+	}
+
+	// Dropping a proxy closes its client, so two fewer clients remain
+	h.store.Remove(h.store.List()[0].URL)
+	h.store.Remove(h.store.List()[0].URL)
+	h.CheckAll(context.Background())
+	if n := len(h.clients); n != size-2 {
+		t.Errorf("%d cached clients after removing two proxies, want %d", n, size-2)
+	}
+}
+
+func BenchmarkHealthCheckRound(b *testing.B) {
+	for _, tc := range []struct {
+		name   string
+		cached bool
+	}{{"fresh", false}, {"cached", true}} {
+		b.Run(tc.name, func(b *testing.B) {
+			h, conns := healthPool(b, 20)
+			h.CheckAll(context.Background())
+			conns.Store(0)
+			b.ResetTimer()
+
+			for i := 0; i < b.N; i++ {
+				if !tc.cached {
+					h.closeClients(nil)
+				}
+				h.CheckAll(context.Background())
+			}
+			b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+		})
+	}
+}
+
+// Accept connections on a local port and serve each with handle
+func tcpListener(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// A minimal SOCKS5 server that accepts every CONNECT without dialing out
+func fakeSOCKS5(conn net.Conn) {
+	buf := make([]byte, 262)
+	// Greeting: version, method count, methods
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0})
+	// Request: version, command, reserved, address type, address, port
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+		return
+	}
+	var addrLen int
+	switch buf[3] {
+	case 1:
+		addrLen = net.IPv4len
+	case 4:
+		addrLen = net.IPv6len
+	case 3:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return
+		}
+		addrLen = int(buf[0])
+	}
+	if _, err := io.ReadFull(conn, buf[:addrLen+2]); err != nil {
+		return
+	}
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+}
+
+func TestTCPCheckHandshakesWithSOCKS5(t *testing.T) {
+	h := NewHealthChecker(NewProxyStore(nil), time.Minute, 200*time.Millisecond, "")
+	silent := tcpListener(t, func(conn net.Conn) { io.Copy(io.Discard, conn) })
+	chatty := tcpListener(t, func(conn net.Conn) { conn.Write([]byte("HTTP/1.1 400 Bad Request\r\n\r\n")) })
+	socks := tcpListener(t, fakeSOCKS5)
+
+	tests := []struct {
+		proxy   string
+		healthy bool
+	}{
+		{"socks5://" + socks, true},
+		{"socks5://" + silent, false},
+		{"socks5://" + chatty, false},
+		// HTTP proxies only need to accept the connection
+		{"http://" + silent, true},
+	}
+	for _, tt := range tests {
+		err := h.check(context.Background(), tt.proxy)
+		if (err == nil) != tt.healthy {
+			t.Errorf("check(%s) = %v, want healthy %v", tt.proxy, err, tt.healthy)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Header carrying the request ID in both directions
+const requestIDHeader = "X-Request-ID"
+
+// Context key holding the request ID
+const requestIDKey = "request_id"
+
+// Install a JSON slog logger on stderr at the level named by LOG_LEVEL
+// (debug, info, warn or error; default info)
+func setupLogger() error {
+	var level slog.Level
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		if err := level.UnmarshalText([]byte(strings.ToLower(v))); err != nil {
+			return fmt.Errorf("LOG_LEVEL: %w", err)
+		}
+	}
+
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+	return nil
+}
+
+// Log msg with err and exit non-zero
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// Middleware assigning each request an ID, echoing the client's X-Request-ID
+// when supplied, and returning it in the response header
+func requestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// The ID assigned to the request by requestIDMiddleware
+func requestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// Generate a random 128-bit request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// Middleware writing one JSON log line per request, except for skipPaths
+func requestLogger(skipPaths ...string) gin.HandlerFunc {
+	skip := make(map[string]bool, len(skipPaths))
+	for _, p := range skipPaths {
+		skip[p] = true
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if skip[c.Request.URL.Path] {
+			return
+		}
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+
+		slog.Log(c.Request.Context(), level, "request",
+			"request_id", requestID(c),
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"status", status,
+			"latency_ms", float64(time.Since(start))/float64(time.Millisecond),
+			"client_ip", c.ClientIP(),
+		)
+	}
+}
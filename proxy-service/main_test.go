@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(m.Run())
+}
+
+// Point the handlers at a fresh store holding the given proxies, normalized
+// as they are at startup
+func useStore(t *testing.T, urls ...string) *ProxyStore {
+	t.Helper()
+
+	store = NewProxyStore(dedupeProxies(urls))
+	sessions = NewSessionStore(store, time.Minute)
+	checkouts = NewCheckoutStore(store, time.Minute)
+	return store
+}
+
+// Build a router from cfg, filling in settings a test does not care about
+// with ones that stay out of its way
+func testRouter(t *testing.T, cfg routerConfig) *gin.Engine {
+	t.Helper()
+
+	if cfg.RateLimiter == nil {
+		cfg.RateLimiter = NewRateLimiter(1000, 1000)
+	}
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = 5 * time.Second
+	}
+	if cfg.MaxBodyBytes == 0 {
+		cfg.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	router, err := newRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return router
+}
+
+// Send a request through h and record the response. header holds
+// alternating names and values.
+func serve(h http.Handler, method, target, body string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_service_http_requests_total",
+		Help: "HTTP requests handled, by route, method and status code.",
+	}, []string{"path", "method", "status"})
+
+	proxySelections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_service_proxy_selections_total",
+		Help: "Times each proxy was handed out to a consumer.",
+	}, []string{"proxy"})
+
+	healthCheckDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "proxy_service_health_check_duration_seconds",
+		Help:    "Duration of individual proxy health checks.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	handlerPanics = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "proxy_service_handler_panics_total",
+		Help: "Handler panics recovered, by route.",
+	}, []string{"path"})
+)
+
+// Register gauges that read the pool size straight from the store at scrape time
+func registerPoolMetrics(s *ProxyStore) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "proxy_service_proxies_total",
+		Help: "Proxies in the pool.",
+	}, func() float64 { return float64(s.Len()) })
+
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "proxy_service_proxies_healthy",
+		Help: "Proxies that are healthy and not cooling down.",
+	}, func() float64 { return float64(s.Available()) })
+}
+
+// Middleware counting requests per route. /metrics itself is not counted.
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		path := c.FullPath()
+		if path == "/metrics" {
+			return
+		}
+		if path == "" {
+			path = "unmatched"
+		}
+		httpRequests.WithLabelValues(path, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+	}
+}
+
+// Record that a proxy was handed out
+func observeSelection(p Proxy) {
+	proxySelections.WithLabelValues(proxyLabel(p.URL)).Inc()
+}
+
+// Record how long a health check took
+func observeHealthCheck(d time.Duration) {
+	healthCheckDuration.Observe(d.Seconds())
+}
+
+// Record a recovered panic in a handler for the route
+func observePanic(path string) {
+	handlerPanics.WithLabelValues(path).Inc()
+}
+
+// Identify a proxy by scheme, host and port so credentials never end up in labels
+func proxyLabel(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "invalid"
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestGetProxiesPagination(t *testing.T) {
+	useStore(t, "http://a.example.com:8080", "http://b.example.com:8080", "http://c.example.com:8080")
+	router := testRouter(t, routerConfig{})
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"", 3},
+		{"?limit=2", 2},
+		{"?limit=2&offset=2", 1},
+		{"?offset=3", 0},
+		{"?offset=100", 0},
+		{"?offset=" + strconv.Itoa(math.MaxInt), 0},
+		{"?limit=" + strconv.Itoa(maxPageLimit) + "&offset=" + strconv.Itoa(math.MaxInt-1), 0},
+	}
+	for _, tt := range tests {
+		w := serve(router, http.MethodGet, "/proxies"+tt.query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: status %d, body %s", tt.query, w.Code, w.Body)
+		}
+		var body struct {
+			Proxies []json.RawMessage `json:"proxies"`
+			Total   int               `json:"total"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if len(body.Proxies) != tt.want || body.Total != 3 {
+			t.Errorf("%q: got %d proxies of %d, want %d of 3", tt.query, len(body.Proxies), body.Total, tt.want)
+		}
+	}
+}
+
+func TestGetProxiesPaginationRejectsInvalid(t *testing.T) {
+	useStore(t, "http://a.example.com:8080")
+	router := testRouter(t, routerConfig{})
+
+	for _, query := range []string{"?limit=0", "?limit=501", "?limit=x", "?offset=-1", "?offset=99999999999999999999"} {
+		if w := serve(router, http.MethodGet, "/proxies"+query, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// proxyState is the part of a proxy that survives restarts. Health and
+// latency are left out because the health checker rebuilds them.
+type proxyState struct {
+	URL           string    `json:"url"`
+	Weight        int       `json:"weight"`
+	MaxConns      int       `json:"max_conns,omitempty"`
+	FailCount     int       `json:"fail_count"`
+	CooldownUntil time.Time `json:"cooldown_until"`
+	TotalFailures int       `json:"total_failures,omitempty"`
+	Tags          []string  `json:"tags,omitempty"`
+	Country       string    `json:"country,omitempty"`
+}
+
+// Capture the persistent state of a proxy
+func stateOf(p *Proxy) proxyState {
+	return proxyState{
+		URL:           p.URL,
+		Weight:        p.Weight,
+		MaxConns:      p.MaxConns,
+		FailCount:     p.FailCount,
+		CooldownUntil: p.CooldownUntil,
+		TotalFailures: p.TotalFailures,
+		Tags:          append([]string(nil), p.Tags...),
+		Country:       p.Country,
+	}
+}
+
+// Rebuild a proxy from saved state; it starts healthy like any new proxy
+func (st proxyState) proxy() *Proxy {
+	p := newProxy(Proxy{URL: st.URL, Weight: st.Weight, MaxConns: st.MaxConns, Tags: st.Tags, Country: st.Country})
+	p.FailCount = st.FailCount
+	p.CooldownUntil = st.CooldownUntil
+	p.TotalFailures = st.TotalFailures
+	return p
+}
+
+// Read the pool saved at path. A missing file is reported as os.ErrNotExist.
+func loadState(path string) ([]proxyState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var states []proxyState
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("parse state file %s: %w", path, err)
+	}
+	return states, nil
+}
+
+// Write the pool to path atomically: the data goes to a temporary file in
+// the same directory which then replaces path, so a crash never leaves a
+// half-written file behind
+func saveState(path string, states []proxyState) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// NewProxyStoreFromState creates a store holding previously saved proxies
+func NewProxyStoreFromState(states []proxyState) *ProxyStore {
+	s := NewProxyStore(nil)
+	for _, st := range states {
+		s.proxies = append(s.proxies, st.proxy())
+	}
+	return s
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSaveAndLoadState(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	cooldown := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	states := []proxyState{
+		{URL: "http://u:p@a.example.com:8080", Weight: 3, MaxConns: 5, FailCount: 2, CooldownUntil: cooldown, TotalFailures: 7, Tags: []string{"residential"}, Country: "DE"},
+		{URL: "socks5://b.example.com", Weight: 1},
+	}
+
+	if err := saveState(path, states); err != nil {
+		t.Fatal(err)
+	}
+	// Overwrite to go through the rename onto an existing file
+	if err := saveState(path, states); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("state directory holds %d files, want only the state file", len(entries))
+	}
+
+	loaded, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, states) {
+		t.Fatalf("loadState() = %+v, want %+v", loaded, states)
+	}
+
+	s := NewProxyStoreFromState(loaded)
+	got := s.List()
+	if len(got) != 2 {
+		t.Fatalf("restored %d proxies, want 2", len(got))
+	}
+	p := got[0]
+	if p.URL != states[0].URL || p.Weight != 3 || p.MaxConns != 5 || p.FailCount != 2 ||
+		!p.CooldownUntil.Equal(cooldown) || p.TotalFailures != 7 || p.Country != "DE" ||
+		!reflect.DeepEqual(p.Tags, []string{"residential"}) || !p.Healthy {
+		t.Errorf("restored %+v from %+v", p, states[0])
+	}
+}
+
+func TestLoadStateMissingFile(t *testing.T) {
+	_, err := loadState(filepath.Join(t.TempDir(), "missing.json"))
+	if !os.IsNotExist(err) {
+		t.Fatalf("loadState on a missing file: %v, want a not-exist error", err)
+	}
+}
+
+func TestStorePersistsChangesAndReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s := NewProxyStore([]string{"http://a.example.com:8080"})
+	s.SetStateFile(path)
+
+	if _, ok := s.Add(Proxy{URL: "http://b.example.com:8080", Weight: 2}); !ok {
+		t.Fatal("Add failed")
+	}
+	s.Report("http://a.example.com:8080", false, time.Now())
+
+	states, err := loadState(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded := NewProxyStoreFromState(states).List()
+	if len(reloaded) != 2 || reloaded[0].FailCount != 1 || reloaded[1].Weight != 2 {
+		t.Fatalf("reloaded %+v", reloaded)
+	}
+}
+
+func TestSuccessReportWithNothingToClearSkipsSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	const url = "http://a.example.com:8080"
+	s := NewProxyStore([]string{url})
+	s.SetStateFile(path)
+
+	s.Report(url, true, time.Now())
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("a success report for a clean proxy wrote the state file (stat: %v)", err)
+	}
+
+	s.Report(url, false, time.Now())
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("a failure report did not write the state file: %v", err)
+	}
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	// Clearing the failure is a change worth saving
+	s.Report(url, true, time.Now())
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("a success clearing a failure did not write the state file: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A *rand.Rand behind a mutex, since *rand.Rand is not safe for concurrent use
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{r: rand.New(rand.NewSource(seed))}
+}
+
+// Restart the sequence from seed
+func (l *lockedRand) seed(seed int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.r = rand.New(rand.NewSource(seed))
+}
+
+// Return a pseudo-random number in [0, n)
+func (l *lockedRand) Intn(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.r.Intn(n)
+}
+
+// Return a pseudo-random number in [0, n)
+func (l *lockedRand) Int63n(n int64) int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.r.Int63n(n)
+}
+
+var (
+	// Selection RNG, seeded once at startup or from SELECTION_SEED
+	rng = newLockedRand(time.Now().UnixNano())
+	// Retry jitter and dry-run picks draw from their own generators, so
+	// background retries such as webhook deliveries and previews never shift
+	// the sequence of selections SELECTION_SEED fixes
+	jitterRng  = newLockedRand(time.Now().UnixNano())
+	previewRng = newLockedRand(time.Now().UnixNano())
+)
+
+// Reseed the selection RNG so the sequence of random picks repeats across runs
+func seedRNG(seed int64) {
+	rng.seed(seed)
+}
+
+// Reseed the selection RNG from SELECTION_SEED if it is set, reporting the
+// seed and whether it was
+func seedFromEnv() (int64, bool, error) {
+	v := os.Getenv("SELECTION_SEED")
+	if v == "" {
+		return 0, false, nil
+	}
+	seed, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("SELECTION_SEED: %q is not an integer", v)
+	}
+	seedRNG(seed)
+	return seed, true, nil
+}
+
+// Return a pseudo-random number in [0, n) from the selection RNG
+func randIntn(n int) int {
+	return rng.Intn(n)
+}
+
+// Return a pseudo-random number in [0, n) for a selection, or for a dry run
+// when commit is false
+func selectionIntn(n int, commit bool) int {
+	if commit {
+		return rng.Intn(n)
+	}
+	return previewRng.Intn(n)
+}
+
+// Return a pseudo-random number in [0, n) from the jitter RNG
+func jitterInt63n(n int64) int64 {
+	return jitterRng.Int63n(n)
+}
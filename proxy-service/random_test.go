@@ -0,0 +1,30 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// What selection used to do: seed a new generator for every pick
+func BenchmarkRandIntnPerRequestSeed(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		rand.New(rand.NewSource(time.Now().UnixNano())).Intn(100)
+	}
+}
+
+// The generator seeded once at startup
+func BenchmarkRandIntn(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		randIntn(100)
+	}
+}
+
+// The same under contention, as when many requests select at once
+func BenchmarkRandIntnParallel(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			randIntn(100)
+		}
+	})
+}
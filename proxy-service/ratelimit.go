@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// How long a client may stay silent before its limiter is dropped
+const rateLimiterIdleTTL = 3 * time.Minute
+
+// Paths that are never rate limited so probes cannot be throttled
+var rateLimitExemptPaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+// RateLimiter hands out a token bucket per client IP
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    rate.Limit
+	burst   int
+	clients map[string]*clientLimiter
+}
+
+type clientLimiter struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// NewRateLimiter allows each client rps requests per second with bursts of burst
+func NewRateLimiter(rps float64, burst int) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate.Limit(rps),
+		burst:   burst,
+		clients: make(map[string]*clientLimiter),
+	}
+}
+
+// Get the limiter for ip, creating it on first use
+func (rl *RateLimiter) limiter(ip string, now time.Time) *rate.Limiter {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	cl, ok := rl.clients[ip]
+	if !ok {
+		cl = &clientLimiter{limiter: rate.NewLimiter(rl.rate, rl.burst)}
+		rl.clients[ip] = cl
+	}
+	cl.lastSeen = now
+	return cl.limiter
+}
+
+// Middleware answering 429 with a Retry-After header once a client runs out
+// of tokens
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if rateLimitExemptPaths[c.Request.URL.Path] {
+			c.Next()
+			return
+		}
+
+		now := time.Now()
+		reservation := rl.limiter(c.ClientIP(), now).ReserveN(now, 1)
+		if delay := reservation.DelayFrom(now); delay > 0 {
+			reservation.CancelAt(now)
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			respondError(c, http.StatusTooManyRequests, errRateLimited, "Rate limit exceeded")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// Run drops limiters of idle clients periodically until ctx is done
+func (rl *RateLimiter) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			rl.expire(now)
+		}
+	}
+}
+
+// Drop limiters not used within rateLimiterIdleTTL of now
+func (rl *RateLimiter) expire(now time.Time) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for ip, cl := range rl.clients {
+		if now.Sub(cl.lastSeen) > rateLimiterIdleTTL {
+			delete(rl.clients, ip)
+		}
+	}
+}
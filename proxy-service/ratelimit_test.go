@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	useStore(t, "http://proxy.example.com:8080")
+	router := testRouter(t, routerConfig{RateLimiter: NewRateLimiter(1, 1)})
+
+	for i, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.3"} {
+		w := serve(router, http.MethodGet, "/proxies", "", "X-Forwarded-For", ip)
+		want := http.StatusTooManyRequests
+		if i == 0 {
+			want = http.StatusOK
+		}
+		if w.Code != want {
+			t.Fatalf("request %d with X-Forwarded-For %s: status %d, want %d", i+1, ip, w.Code, want)
+		}
+	}
+}
+
+func TestRateLimitHonoursTrustedProxy(t *testing.T) {
+	useStore(t, "http://proxy.example.com:8080")
+	// httptest requests come from 192.0.2.1
+	router := testRouter(t, routerConfig{
+		RateLimiter:    NewRateLimiter(1, 1),
+		TrustedProxies: []string{"192.0.2.0/24"},
+	})
+
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2"} {
+		if w := serve(router, http.MethodGet, "/proxies", "", "X-Forwarded-For", ip); w.Code != http.StatusOK {
+			t.Fatalf("client %s: status %d, want %d", ip, w.Code, http.StatusOK)
+		}
+	}
+	if w := serve(router, http.MethodGet, "/proxies", "", "X-Forwarded-For", "198.51.100.1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("repeat client: status %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestNewRouterRejectsInvalidTrustedProxy(t *testing.T) {
+	if _, err := newRouter(routerConfig{RateLimiter: NewRateLimiter(1, 1), TrustedProxies: []string{"not-an-ip"}}); err == nil {
+		t.Fatal("newRouter accepted an invalid trusted proxy")
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware turning a handler panic into a 500 with the error envelope. The
+// panic and its stack are logged with the request ID but never sent to the
+// client. Panics with http.ErrAbortHandler are passed on so net/http drops
+// the connection as the handler intended.
+func recoveryMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+
+			path := c.FullPath()
+			if path == "" {
+				path = "unmatched"
+			}
+			observePanic(path)
+			slog.Error("Handler panicked",
+				"request_id", requestID(c),
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+				"panic", fmt.Sprint(rec),
+				"stack", string(debug.Stack()),
+			)
+
+			// Part of a response may already be out, in which case the client
+			// sees it cut short
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			respondError(c, http.StatusInternalServerError, errInternal, "Internal server error")
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func panicRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(requestIDMiddleware(), recoveryMiddleware())
+	router.GET("/panic", func(c *gin.Context) {
+		panic("database password is hunter2")
+	})
+	router.GET("/abort", func(c *gin.Context) {
+		panic(http.ErrAbortHandler)
+	})
+	return router
+}
+
+func TestRecoveryReturnsCleanError(t *testing.T) {
+	w := serve(panicRouter(), http.MethodGet, "/panic", "")
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "hunter2") {
+		t.Errorf("panic value leaked to the client: %s", w.Body)
+	}
+
+	var body struct {
+		Error struct {
+			Code      string `json:"code"`
+			Message   string `json:"message"`
+			RequestID string `json:"request_id"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %s: %v", w.Body, err)
+	}
+	if body.Error.Code != errInternal || body.Error.Message != "Internal server error" {
+		t.Errorf("error = %+v, want %s with a generic message", body.Error, errInternal)
+	}
+	if id := w.Header().Get(requestIDHeader); id == "" || body.Error.RequestID != id {
+		t.Errorf("request_id %q, want the %s header %q", body.Error.RequestID, requestIDHeader, id)
+	}
+}
+
+func TestRecoveryPassesOnAbortHandler(t *testing.T) {
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler passed on", rec)
+		}
+	}()
+	serve(panicRouter(), http.MethodGet, "/abort", "")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetryPolicy controls how often and how far apart a failing operation is
+// retried
+type RetryPolicy struct {
+	// Attempts in total, including the first
+	MaxAttempts int
+	// Upper bound of the delay before the first retry; it doubles each time
+	BaseDelay time.Duration
+	// Cap on the delay between attempts
+	MaxDelay time.Duration
+}
+
+// Retry policy used until main applies the RETRY_* settings
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+}
+
+// Backoff returns a random delay before retry number n (starting at 1), up
+// to BaseDelay doubled n-1 times and capped at MaxDelay. Full jitter spreads
+// out clients that failed together.
+func (p RetryPolicy) Backoff(n int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < n && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(jitterInt63n(int64(ceiling)))
+}
+
+// Error wrapped by stopRetry
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Mark err as not worth retrying, so retry returns it at once
+func stopRetry(err error) error {
+	return permanentError{err}
+}
+
+// Call try until it succeeds, returns an error wrapped by stopRetry, or the
+// policy's attempts run out, waiting Backoff between attempts. It gives up
+// early if ctx ends while waiting. It returns the number of attempts made
+// and the last error, unwrapped if it was permanent.
+func retry(ctx context.Context, policy RetryPolicy, try func(attempt int) error) (int, error) {
+	var err error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			timer := time.NewTimer(policy.Backoff(attempt - 1))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return attempt - 1, err
+			case <-timer.C:
+			}
+		}
+
+		if err = try(attempt); err == nil {
+			return attempt, nil
+		}
+		var permanent permanentError
+		if errors.As(err, &permanent) {
+			return attempt, permanent.err
+		}
+	}
+	return policy.MaxAttempts, err
+}
+
+// Response header reporting how many proxies a request went through
+const proxiesTriedHeader = "X-Proxies-Tried"
+
+// Returned by throughPool when the pool has no available proxy left to try
+var errNoUntriedProxy = errors.New("no untried proxy available")
+
+// Run op through proxies picked at random from the pool narrowed by filters,
+// a different one on each attempt, retrying per policy. Each attempt holds
+// one of its proxy's connection slots until op returns. op is told which
+// attempt it is, which is also the number of proxies tried so far. Every proxy whose
+// attempt fails is reported as failed, unless the request itself was
+// cancelled. It returns how many proxies were tried and the last error;
+// errNoUntriedProxy if the pool ran out before any attempt was made.
+func throughPool(c *gin.Context, policy RetryPolicy, filters []ProxyFilter, name string, op func(ctx context.Context, proxy Proxy, attempt int) error) (int, error) {
+	ctx := c.Request.Context()
+	tried := make(map[string]bool)
+	notTried := func(p *Proxy) bool { return !tried[p.URL] }
+
+	var lastErr error
+	_, err := retry(ctx, policy, func(attempt int) error {
+		proxy, err := store.Checkout(strategyWeighted, append(filters, notTried)...)
+		if err != nil {
+			if lastErr != nil {
+				return stopRetry(lastErr)
+			}
+			return stopRetry(errNoUntriedProxy)
+		}
+		defer store.Release(proxy.URL)
+		tried[proxy.URL] = true
+		observeSelection(*proxy)
+
+		spanCtx, span := startProxySpan(ctx, name, proxy.URL)
+		lastErr = op(spanCtx, *proxy, attempt)
+		endSpan(span, lastErr)
+		if lastErr != nil && ctx.Err() == nil {
+			store.Report(proxy.URL, false, time.Now())
+			slog.Warn("Proxy attempt failed",
+				"request_id", requestID(c),
+				"operation", name,
+				"proxy", maskCredentials(proxy.URL),
+				"error", lastErr,
+			)
+		}
+		return lastErr
+	})
+	return len(tried), err
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Retry policy that does not sleep between attempts
+var instantRetries = RetryPolicy{MaxAttempts: 3}
+
+// A gin context for calling throughPool outside a router
+func poolContext() *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/forward", nil)
+	return c
+}
+
+func TestThroughPoolRetriesOnOtherProxies(t *testing.T) {
+	s := useStore(t, "http://a.example.com:8080", "http://b.example.com:8080", "http://c.example.com:8080", "http://d.example.com:8080")
+	const failFirst = 2
+
+	var used []string
+	tried, err := throughPool(poolContext(), instantRetries, nil, "test", func(_ context.Context, p Proxy, attempt int) error {
+		if attempt != len(used)+1 {
+			t.Errorf("attempt %d after %d proxies", attempt, len(used))
+		}
+		used = append(used, p.URL)
+		if attempt <= failFirst {
+			return errors.New("upstream refused")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("throughPool: %v", err)
+	}
+	if tried != failFirst+1 {
+		t.Fatalf("tried %d proxies, want %d", tried, failFirst+1)
+	}
+
+	seen := make(map[string]bool)
+	for _, u := range used {
+		if seen[u] {
+			t.Fatalf("proxy %s used twice: %v", u, used)
+		}
+		seen[u] = true
+	}
+	for i, u := range used {
+		wantFails := 0
+		if i < failFirst {
+			wantFails = 1
+		}
+		if p := s.List(URLFilter(u))[0]; p.FailCount != wantFails {
+			t.Errorf("%s: fail_count %d, want %d", u, p.FailCount, wantFails)
+		}
+	}
+}
+
+func TestThroughPoolGivesUpAfterMaxAttempts(t *testing.T) {
+	useStore(t, "http://a.example.com:8080", "http://b.example.com:8080", "http://c.example.com:8080", "http://d.example.com:8080")
+	failure := errors.New("upstream refused")
+
+	tried, err := throughPool(poolContext(), instantRetries, nil, "test", func(context.Context, Proxy, int) error {
+		return failure
+	})
+	if !errors.Is(err, failure) || tried != instantRetries.MaxAttempts {
+		t.Fatalf("got %d tries and %v, want %d and %v", tried, err, instantRetries.MaxAttempts, failure)
+	}
+}
+
+func TestThroughPoolStopsWhenPoolRunsOut(t *testing.T) {
+	useStore(t, "http://a.example.com:8080", "http://b.example.com:8080")
+	failure := errors.New("upstream refused")
+
+	tried, err := throughPool(poolContext(), RetryPolicy{MaxAttempts: 5}, nil, "test", func(context.Context, Proxy, int) error {
+		return failure
+	})
+	if !errors.Is(err, failure) || tried != 2 {
+		t.Fatalf("got %d tries and %v, want 2 and %v", tried, err, failure)
+	}
+
+	useStore(t)
+	tried, err = throughPool(poolContext(), instantRetries, nil, "test", func(context.Context, Proxy, int) error {
+		t.Fatal("op called with an empty pool")
+		return nil
+	})
+	if !errors.Is(err, errNoUntriedProxy) || tried != 0 {
+		t.Fatalf("empty pool: got %d tries and %v, want 0 and %v", tried, err, errNoUntriedProxy)
+	}
+}
+
+func TestBackoffStaysWithinBounds(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 9: time.Second} {
+		for i := 0; i < 100; i++ {
+			if d := policy.Backoff(n); d < 0 || d >= ceiling {
+				t.Fatalf("Backoff(%d) = %v, want within [0, %v)", n, d, ceiling)
+			}
+		}
+	}
+}
+
+func TestBackoffLeavesSelectionRNGAlone(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Second}
+	t.Cleanup(func() { seedRNG(time.Now().UnixNano()) })
+
+	draw := func(jitter bool) []int {
+		seedRNG(42)
+		var out []int
+		for i := 0; i < 20; i++ {
+			if jitter {
+				policy.Backoff(1)
+			}
+			out = append(out, randIntn(1000))
+		}
+		return out
+	}
+	plain, withJitter := draw(false), draw(true)
+	for i := range plain {
+		if plain[i] != withJitter[i] {
+			t.Fatalf("retry backoff changed selection draw %d: %d, want %d", i, withJitter[i], plain[i])
+		}
+	}
+}
+
+func TestThroughPoolHoldsConnectionSlots(t *testing.T) {
+	s := useStore(t, "http://a.example.com:8080", "http://b.example.com:8080")
+	for _, p := range s.proxies {
+		p.MaxConns = 1
+	}
+	full := s.proxies[0]
+	if !full.acquire() {
+		t.Fatal("could not take the only slot")
+	}
+
+	var used []string
+	tried, err := throughPool(poolContext(), instantRetries, nil, "test", func(_ context.Context, p Proxy, _ int) error {
+		used = append(used, p.URL)
+		if n := s.proxies[1].counters.active.Load(); n != 1 {
+			t.Errorf("active checkouts during the attempt = %d, want 1", n)
+		}
+		return errors.New("upstream refused")
+	})
+	if err == nil {
+		t.Fatal("throughPool succeeded with every attempt failing")
+	}
+	if tried != 1 || len(used) != 1 || used[0] == full.URL {
+		t.Fatalf("tried %v, want only the proxy below capacity", used)
+	}
+	if n := s.proxies[1].counters.active.Load(); n != 0 {
+		t.Errorf("active checkouts after throughPool = %d, want 0", n)
+	}
+	if n := full.counters.active.Load(); n != 1 {
+		t.Errorf("checkout held elsewhere was touched: active = %d, want 1", n)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SessionStore pins session keys to proxies so a client keeps the same
+// proxy for the lifetime of a session
+type SessionStore struct {
+	mu       sync.Mutex
+	store    *ProxyStore
+	ttl      time.Duration
+	sessions map[string]sessionEntry
+}
+
+type sessionEntry struct {
+	url       string
+	expiresAt time.Time
+}
+
+// SessionAssignment is the proxy a session is pinned to
+type SessionAssignment struct {
+	Proxy     Proxy
+	ExpiresAt time.Time
+	// The previously pinned proxy became unusable and a new one was chosen
+	Reassigned bool
+}
+
+// NewSessionStore creates a session store drawing proxies from store
+func NewSessionStore(store *ProxyStore, ttl time.Duration) *SessionStore {
+	return &SessionStore{
+		store:    store,
+		ttl:      ttl,
+		sessions: make(map[string]sessionEntry),
+	}
+}
+
+// Assign returns the proxy pinned to key, pinning a new randomly chosen one
+// when the session is new or expired, or when its proxy is no longer
+// available or no longer matches the filters. It reports false if no proxy
+// can be assigned.
+func (ss *SessionStore) Assign(key string, filters []ProxyFilter, now time.Time) (SessionAssignment, bool) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	entry, exists := ss.sessions[key]
+	if exists && now.Before(entry.expiresAt) {
+		if p, err := ss.store.SelectProxy(strategyWeighted, append(filters, URLFilter(entry.url))...); err == nil {
+			return SessionAssignment{Proxy: *p, ExpiresAt: entry.expiresAt}, true
+		}
+	} else {
+		exists = false
+	}
+
+	p, err := ss.store.SelectProxy(strategyWeighted, filters...)
+	if err != nil {
+		return SessionAssignment{}, false
+	}
+
+	entry = sessionEntry{url: p.URL, expiresAt: now.Add(ss.ttl)}
+	ss.sessions[key] = entry
+	return SessionAssignment{Proxy: *p, ExpiresAt: entry.expiresAt, Reassigned: exists}, true
+}
+
+// Run drops expired sessions periodically until ctx is done
+func (ss *SessionStore) Run(ctx context.Context) {
+	ticker := time.NewTicker(ss.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ss.expire(now)
+		}
+	}
+}
+
+// Drop sessions that expired before now
+func (ss *SessionStore) expire(now time.Time) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for key, entry := range ss.sessions {
+		if !now.Before(entry.expiresAt) {
+			delete(ss.sessions, key)
+		}
+	}
+}
@@ -0,0 +1,858 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Proxy is a pool entry together with its last known health
+type Proxy struct {
+	URL         string    `json:"url"`
+	Healthy     bool      `json:"healthy"`
+	LastChecked time.Time `json:"last_checked"`
+
+	// Rolling average of successful check round trips, zero until measured
+	Latency time.Duration `json:"-"`
+
+	// Consecutive failures reported by consumers, and the time until which
+	// the proxy is held back from selection after too many of them
+	FailCount     int       `json:"fail_count"`
+	CooldownUntil time.Time `json:"cooldown_until"`
+
+	// Failed reports and health checks over the proxy's lifetime
+	TotalFailures int `json:"total_failures"`
+
+	// Relative share of random selections; zero disables the proxy
+	Weight int `json:"weight"`
+
+	// Most checkouts, through GET /proxy/leastconn or by forward and test
+	// attempts, allowed at once before the proxy is withheld from every
+	// strategy, zero for no limit
+	MaxConns int `json:"max_conns"`
+
+	// Named groups the proxy belongs to
+	Tags []string `json:"tags"`
+
+	// ISO 3166-1 alpha-2 code of the proxy's exit country, if known
+	Country string `json:"country,omitempty"`
+
+	// Checkouts not yet released, including forward and test attempts in
+	// flight, as of when the snapshot was taken
+	ActiveConns int64 `json:"active_conns"`
+
+	// Circuit breaker state as of when the snapshot was taken
+	Breaker string `json:"breaker"`
+
+	// Set on the snapshot returned by the report that evicted the proxy
+	Evicted bool `json:"evicted,omitempty"`
+
+	// Percentage of the last uptimeWindow health checks that passed, and how
+	// many checks that covers, as of when the snapshot was taken
+	Uptime       float64 `json:"-"`
+	UptimeChecks int     `json:"uptime_checks"`
+
+	// Recent health check outcomes
+	history *checkHistory
+
+	// Live counters, shared by every snapshot and updated atomically
+	counters *proxyCounters
+
+	// Circuit breaker fed by reports and health checks, shared by every snapshot
+	breaker *breaker
+}
+
+// Counters updated on the selection path without taking the store's write lock
+type proxyCounters struct {
+	active       atomic.Int64
+	selections   atomic.Uint64
+	lastSelected atomic.Int64 // Unix nanoseconds, zero if never selected
+}
+
+// Record that the proxy was handed out at now
+func (pc *proxyCounters) recordSelection(now time.Time) {
+	pc.selections.Add(1)
+	pc.lastSelected.Store(now.UnixNano())
+}
+
+// Create a healthy pool entry with its own connection counter from the
+// settings a caller may choose: URL, weight, connection limit, tags and country
+func newProxy(settings Proxy) *Proxy {
+	return &Proxy{
+		URL:      settings.URL,
+		Healthy:  true,
+		Weight:   settings.Weight,
+		MaxConns: settings.MaxConns,
+		Tags:     append([]string(nil), settings.Tags...),
+		Country:  settings.Country,
+		counters: new(proxyCounters),
+		breaker:  newBreaker(),
+		history:  newCheckHistory(uptimeWindow),
+	}
+}
+
+// Weight given to proxies that do not specify one
+const defaultWeight = 1
+
+// Connection limit given to proxies that do not specify one, set from
+// DEFAULT_MAX_CONNS at startup; zero means unlimited
+var defaultMaxConns = 0
+
+// Weight given to the newest sample in the rolling latency average
+const latencySmoothing = 0.3
+
+// MarshalJSON renders latency in milliseconds, and unset timestamps,
+// latencies and uptimes as null
+func (p Proxy) MarshalJSON() ([]byte, error) {
+	type alias Proxy
+	var lastChecked *time.Time
+	if !p.LastChecked.IsZero() {
+		lastChecked = &p.LastChecked
+	}
+	var cooldownUntil *time.Time
+	if !p.CooldownUntil.IsZero() {
+		cooldownUntil = &p.CooldownUntil
+	}
+	if p.Tags == nil {
+		p.Tags = []string{}
+	}
+	var latencyMS *float64
+	if p.Latency > 0 {
+		ms := float64(p.Latency) / float64(time.Millisecond)
+		latencyMS = &ms
+	}
+	var uptime *float64
+	if p.UptimeChecks > 0 {
+		uptime = &p.Uptime
+	}
+
+	return json.Marshal(struct {
+		alias
+		LastChecked   *time.Time `json:"last_checked"`
+		LatencyMS     *float64   `json:"latency_ms"`
+		CooldownUntil *time.Time `json:"cooldown_until"`
+		Uptime        *float64   `json:"uptime"`
+	}{alias(p), lastChecked, latencyMS, cooldownUntil, uptime})
+}
+
+// Copy the proxy so the snapshot shares no slices with the store
+func (p *Proxy) snapshot() Proxy {
+	cp := *p
+	cp.Tags = append([]string(nil), p.Tags...)
+	cp.ActiveConns = p.counters.active.Load()
+	cp.Breaker = p.breaker.State(time.Now())
+	cp.Uptime, cp.UptimeChecks = p.history.uptime()
+	cp.history = nil
+	return cp
+}
+
+// InCooldown reports whether the proxy is held back from selection at now
+func (p *Proxy) InCooldown(now time.Time) bool {
+	return now.Before(p.CooldownUntil)
+}
+
+// Whether the proxy has as many active checkouts as its limit allows
+func (p *Proxy) atCapacity() bool {
+	return p.MaxConns > 0 && p.counters.active.Load() >= int64(p.MaxConns)
+}
+
+// Take one of the proxy's connection slots, reporting false if it is at
+// capacity. The check and increment are one atomic step, so concurrent
+// checkouts cannot overshoot the limit.
+func (p *Proxy) acquire() bool {
+	for {
+		n := p.counters.active.Load()
+		if p.MaxConns > 0 && n >= int64(p.MaxConns) {
+			return false
+		}
+		if p.counters.active.CompareAndSwap(n, n+1) {
+			return true
+		}
+	}
+}
+
+// Whether the proxy's circuit breaker holds it back from selection at now
+func (p *Proxy) breakerBlocks(now time.Time) bool {
+	_, blocked := p.breaker.Blocked(now)
+	return blocked
+}
+
+// CooldownPolicy decides when reported failures take a proxy out of rotation
+type CooldownPolicy struct {
+	// Consecutive failures that trigger a cooldown
+	Threshold int
+	// How long the proxy stays out of rotation
+	Duration time.Duration
+}
+
+// Cooldown policy used until SetCooldownPolicy is called
+var defaultCooldownPolicy = CooldownPolicy{Threshold: 3, Duration: 5 * time.Minute}
+
+// ProxyStore guards the proxy list so handlers can read and mutate it concurrently
+type ProxyStore struct {
+	mu       sync.RWMutex
+	proxies  []*Proxy
+	cursor   atomic.Uint64
+	cooldown CooldownPolicy
+	breaker  BreakerPolicy
+
+	// Lifetime failures after which a proxy is removed, zero to keep it forever
+	evictAfter int
+
+	// File the pool is saved to after every change; empty disables saving
+	stateFile string
+
+	// When the health checker will next run, zero if unknown
+	nextCheck time.Time
+
+	// Receives health and eviction events; nil to send none
+	notifier *Notifier
+}
+
+// NewProxyStore creates a store holding the given proxies at the default
+// weight and connection limit. Proxies start out healthy until the first health check says otherwise.
+func NewProxyStore(urls []string) *ProxyStore {
+	s := &ProxyStore{cooldown: defaultCooldownPolicy, breaker: defaultBreakerPolicy}
+	for _, u := range urls {
+		s.proxies = append(s.proxies, newProxy(Proxy{URL: u, Weight: defaultWeight, MaxConns: defaultMaxConns}))
+	}
+	return s
+}
+
+// List returns a snapshot of the proxies accepted by the filters
+func (s *ProxyStore) List(filters ...ProxyFilter) []Proxy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Proxy, 0, len(s.proxies))
+	for _, p := range s.proxies {
+		if matchAll(p, filters) {
+			out = append(out, p.snapshot())
+		}
+	}
+	return out
+}
+
+// Count returns how many proxies the filters accept, healthy or not
+func (s *ProxyStore) Count(filters ...ProxyFilter) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, p := range s.proxies {
+		if matchAll(p, filters) {
+			n++
+		}
+	}
+	return n
+}
+
+// Available returns how many proxies the filters accept that can be
+// handed out right now
+func (s *ProxyStore) Available(filters ...ProxyFilter) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.available(filters))
+}
+
+// Countries returns the distinct countries of the proxies in the pool, sorted
+func (s *ProxyStore) Countries() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	countries := []string{}
+	for _, p := range s.proxies {
+		if p.Country != "" && !seen[p.Country] {
+			seen[p.Country] = true
+			countries = append(countries, p.Country)
+		}
+	}
+	sort.Strings(countries)
+	return countries
+}
+
+// Len returns the number of proxies in the store
+func (s *ProxyStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.proxies)
+}
+
+// Add appends a proxy and returns the new count, reporting false if a proxy
+// with the same URL is already present. Only the URL and the settings a
+// caller may choose are kept; runtime state starts fresh.
+func (s *ProxyStore) Add(p Proxy) (int, bool) {
+	added, count := s.AddMany([]Proxy{p})
+	return count, added[0]
+}
+
+// AddMany appends several proxies in one step, so readers see either none or
+// all of them. It reports for each whether it was added or skipped as a
+// duplicate of an existing or earlier entry, and returns the new count.
+func (s *ProxyStore) AddMany(ps []Proxy) ([]bool, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing := make(map[string]bool, len(s.proxies))
+	for _, p := range s.proxies {
+		existing[p.URL] = true
+	}
+
+	added := make([]bool, len(ps))
+	changed := false
+	for i, p := range ps {
+		if existing[p.URL] {
+			continue
+		}
+		existing[p.URL] = true
+		s.proxies = append(s.proxies, newProxy(p))
+		added[i] = true
+		changed = true
+	}
+
+	if changed {
+		s.persist()
+	}
+	return added, len(s.proxies)
+}
+
+// Remove deletes the first matching proxy and returns the new count,
+// reporting false if it was not present
+func (s *ProxyStore) Remove(url string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, p := range s.proxies {
+		if p.URL == url {
+			s.proxies = append(s.proxies[:i], s.proxies[i+1:]...)
+			s.persist()
+			s.watchHealthy(time.Now())
+			return len(s.proxies), true
+		}
+	}
+	return len(s.proxies), false
+}
+
+// SetHealth records the outcome of a health check, folding the round trip
+// of a successful check into the latency average. A failed check counts
+// towards eviction, and it reports whether the proxy was evicted. Proxies
+// removed while the check was running are ignored.
+func (s *ProxyStore) SetHealth(url string, healthy bool, latency time.Duration, checked time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, p := range s.proxies {
+		if p.URL != url {
+			continue
+		}
+
+		wasHealthy := p.Healthy
+		p.Healthy = healthy
+		p.LastChecked = checked
+		p.history.record(healthy)
+		p.breaker.record(healthy, checked, s.breaker)
+		if healthy {
+			p.Latency = smoothLatency(p.Latency, latency)
+			s.watchHealthy(checked)
+			return false
+		}
+
+		if wasHealthy {
+			s.emit(eventProxyUnhealthy, p, checked)
+		}
+		p.TotalFailures++
+		evicted := s.evictable(p)
+		if evicted {
+			s.evict(i, "health_check")
+			s.persist()
+		}
+		s.watchHealthy(checked)
+		return evicted
+	}
+	return false
+}
+
+// Blend a new latency sample into the running average
+func smoothLatency(avg, sample time.Duration) time.Duration {
+	if avg == 0 {
+		return sample
+	}
+	return time.Duration(latencySmoothing*float64(sample) + (1-latencySmoothing)*float64(avg))
+}
+
+// SetStateFile makes the store save itself to path after every change
+func (s *ProxyStore) SetStateFile(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stateFile = path
+}
+
+// Save the pool if a state file is configured; callers must hold the write lock
+func (s *ProxyStore) persist() {
+	if s.stateFile == "" {
+		return
+	}
+
+	states := make([]proxyState, len(s.proxies))
+	for i, p := range s.proxies {
+		states[i] = stateOf(p)
+	}
+	if err := saveState(s.stateFile, states); err != nil {
+		slog.Error("Failed to save proxy state", "file", s.stateFile, "error", err)
+	}
+}
+
+// SetCooldownPolicy replaces the policy applied to reported failures
+func (s *ProxyStore) SetCooldownPolicy(policy CooldownPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cooldown = policy
+}
+
+// SetBreakerPolicy replaces the policy applied to every proxy's circuit breaker
+func (s *ProxyStore) SetBreakerPolicy(policy BreakerPolicy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.breaker = policy
+}
+
+// SetEvictionThreshold makes the store remove proxies once they reach the
+// given number of lifetime failures; zero disables eviction
+func (s *ProxyStore) SetEvictionThreshold(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.evictAfter = n
+}
+
+// Whether p has failed often enough to be evicted; callers must hold the lock
+func (s *ProxyStore) evictable(p *Proxy) bool {
+	return s.evictAfter > 0 && p.TotalFailures >= s.evictAfter
+}
+
+// Remove the proxy at index i after too many failures, naming what recorded
+// the last one; callers must hold the write lock and persist afterwards
+func (s *ProxyStore) evict(i int, source string) {
+	p := s.proxies[i]
+	s.proxies = append(s.proxies[:i], s.proxies[i+1:]...)
+	slog.Warn("Evicted proxy after repeated failures",
+		"proxy", maskCredentials(p.URL),
+		"total_failures", p.TotalFailures,
+		"source", source,
+	)
+	s.emit(eventProxyEvicted, p, time.Now())
+}
+
+// SetNotifier makes the store report health and eviction events to n
+func (s *ProxyStore) SetNotifier(n *Notifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.notifier = n
+}
+
+// Count the healthy proxies and the whole pool; callers must hold the lock
+func (s *ProxyStore) healthCounts() (healthy, total int) {
+	for _, p := range s.proxies {
+		if p.Healthy {
+			healthy++
+		}
+	}
+	return healthy, len(s.proxies)
+}
+
+// Queue an event about p for the notifier, if any; callers must hold the
+// write lock
+func (s *ProxyStore) emit(kind string, p *Proxy, now time.Time) {
+	if s.notifier == nil {
+		return
+	}
+	healthy, total := s.healthCounts()
+	s.notifier.Notify(Event{
+		Type:      kind,
+		Proxy:     maskCredentials(p.URL),
+		Timestamp: now,
+		Healthy:   healthy,
+		Total:     total,
+	})
+}
+
+// Let the notifier, if any, check the healthy count against its threshold
+// after a change; callers must hold the write lock
+func (s *ProxyStore) watchHealthy(now time.Time) {
+	if s.notifier == nil {
+		return
+	}
+	healthy, total := s.healthCounts()
+	s.notifier.observeHealthy(healthy, total, now)
+}
+
+// Report records a consumer's outcome for a proxy. A success clears the
+// failure count and any cooldown; enough consecutive failures start one.
+// The outcome also feeds the proxy's circuit breaker, and a failure counts
+// towards eviction, in which case the returned snapshot has Evicted set.
+// It reports false if the proxy is not in the pool.
+func (s *ProxyStore) Report(url string, ok bool, now time.Time) (Proxy, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, p := range s.proxies {
+		if p.URL != url {
+			continue
+		}
+
+		p.breaker.record(ok, now, s.breaker)
+		if ok {
+			// Most reports are successes for a proxy with nothing to clear;
+			// skip rewriting the state file for those
+			if p.FailCount != 0 || !p.CooldownUntil.IsZero() {
+				p.FailCount = 0
+				p.CooldownUntil = time.Time{}
+				s.persist()
+			}
+			return p.snapshot(), true
+		}
+
+		// A cooldown that has run its course starts a fresh failure streak
+		if !p.CooldownUntil.IsZero() && !p.InCooldown(now) {
+			p.FailCount = 0
+			p.CooldownUntil = time.Time{}
+		}
+
+		p.FailCount++
+		p.TotalFailures++
+		if p.FailCount >= s.cooldown.Threshold && !p.InCooldown(now) {
+			p.CooldownUntil = now.Add(s.cooldown.Duration)
+		}
+
+		snap := p.snapshot()
+		if s.evictable(p) {
+			s.evict(i, "report")
+			s.watchHealthy(now)
+			snap.Evicted = true
+		}
+		s.persist()
+		return snap, true
+	}
+	return Proxy{}, false
+}
+
+// SetNextCheck records when the health checker will next run
+func (s *ProxyStore) SetNextCheck(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextCheck = t
+}
+
+// Reasons no proxy can be handed out
+const (
+	exhaustedEmpty     = "empty"
+	exhaustedUnhealthy = "all_unhealthy"
+	exhaustedCooldown  = "all_cooling_down"
+	exhaustedMixed     = "unhealthy_or_cooling_down"
+	exhaustedDisabled  = "all_disabled"
+	exhaustedBreaker   = "all_circuits_open"
+	exhaustedCapacity  = "all_at_capacity"
+)
+
+// Suggested wait when proxies are only unavailable for being at capacity
+const capacityRetryDelay = time.Second
+
+// Exhaustion explains why no proxy can be handed out
+type Exhaustion struct {
+	Reason string
+	// Soonest time a proxy may become available again, zero if unknown
+	RetryAt time.Time
+}
+
+// Exhaustion explains why none of the proxies accepted by the filters is
+// available at now, and when the first of them may be again: at the end of
+// its cooldown or open circuit, at the next health check if it is unhealthy
+// and that is known, or the latest of these if several apply. Disabled proxies never come back
+// on their own.
+func (s *ProxyStore) Exhaustion(filters []ProxyFilter, now time.Time) Exhaustion {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var unhealthy, cooling, open, full, enabled int
+	var retryAt time.Time
+	for _, p := range s.proxies {
+		if p.Weight == 0 || !matchAll(p, filters) {
+			continue
+		}
+		enabled++
+
+		var at time.Time
+		if p.InCooldown(now) {
+			cooling++
+			at = p.CooldownUntil
+		}
+		if until, blocked := p.breaker.Blocked(now); blocked {
+			open++
+			if until.After(at) {
+				at = until
+			}
+		}
+		if p.atCapacity() {
+			// A slot frees up whenever a checkout is released, so suggest
+			// retrying shortly
+			full++
+			if soon := now.Add(capacityRetryDelay); soon.After(at) {
+				at = soon
+			}
+		}
+		if !p.Healthy {
+			unhealthy++
+			// With the next check unknown, the cooldown or open circuit is
+			// still the soonest the proxy can be back
+			if s.nextCheck.After(at) {
+				at = s.nextCheck
+			}
+		}
+		if !at.IsZero() && (retryAt.IsZero() || at.Before(retryAt)) {
+			retryAt = at
+		}
+	}
+
+	switch {
+	case enabled == 0 && len(s.proxies) == 0:
+		return Exhaustion{Reason: exhaustedEmpty}
+	case enabled == 0:
+		return Exhaustion{Reason: exhaustedDisabled}
+	case unhealthy == enabled:
+		return Exhaustion{Reason: exhaustedUnhealthy, RetryAt: retryAt}
+	case cooling == enabled:
+		return Exhaustion{Reason: exhaustedCooldown, RetryAt: retryAt}
+	case open == enabled:
+		return Exhaustion{Reason: exhaustedBreaker, RetryAt: retryAt}
+	case full == enabled:
+		return Exhaustion{Reason: exhaustedCapacity, RetryAt: retryAt}
+	default:
+		return Exhaustion{Reason: exhaustedMixed, RetryAt: retryAt}
+	}
+}
+
+// Reasons a proxy in the pool cannot be handed out
+const (
+	excludedUnhealthy = "unhealthy"
+	excludedDisabled  = "disabled"
+	excludedCooldown  = "cooling_down"
+	excludedBreaker   = "circuit_open"
+	excludedCapacity  = "at_capacity"
+)
+
+// Why the proxy cannot be handed out at now, or "" if it can be
+func (p *Proxy) unavailableReason(now time.Time) string {
+	switch {
+	case !p.Healthy:
+		return excludedUnhealthy
+	case p.Weight <= 0:
+		return excludedDisabled
+	case p.InCooldown(now):
+		return excludedCooldown
+	case p.breakerBlocks(now):
+		return excludedBreaker
+	case p.atCapacity():
+		return excludedCapacity
+	}
+	return ""
+}
+
+// Collect the proxies accepted by the filters that can be handed out right
+// now; callers must hold the lock
+func (s *ProxyStore) available(filters []ProxyFilter) []*Proxy {
+	now := time.Now()
+	var out []*Proxy
+	for _, p := range s.proxies {
+		if matchAll(p, filters) && p.unavailableReason(now) == "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// A picker chooses one of a non-empty list of candidates. With commit false
+// it must leave the store and the selection RNG untouched, so that a dry run
+// goes through the same choice as a real selection without changing what the
+// next one returns.
+type picker func(s *ProxyStore, candidates []*Proxy, commit bool) *Proxy
+
+// Pick with probability proportional to weight
+func pickWeighted(_ *ProxyStore, candidates []*Proxy, commit bool) *Proxy {
+	total := 0
+	for _, p := range candidates {
+		total += p.Weight
+	}
+
+	r := selectionIntn(total, commit)
+	for _, p := range candidates {
+		if r < p.Weight {
+			return p
+		}
+		r -= p.Weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+// Pick with equal probability, regardless of weight
+func pickUniform(_ *ProxyStore, candidates []*Proxy, commit bool) *Proxy {
+	return candidates[selectionIntn(len(candidates), commit)]
+}
+
+// Pick the candidate under the cursor, advancing it only when committing.
+// The cursor is reduced modulo the current number of candidates, so adding,
+// removing, failing or cooling down proxies shifts the rotation but never
+// indexes out of range.
+func pickRoundRobin(s *ProxyStore, candidates []*Proxy, commit bool) *Proxy {
+	i := s.cursor.Load()
+	if commit {
+		i = s.cursor.Add(1) - 1
+	}
+	return candidates[i%uint64(len(candidates))]
+}
+
+// Pick the candidate with the lowest measured latency, falling back to a
+// weighted pick when none has been measured yet
+func pickFastest(s *ProxyStore, candidates []*Proxy, commit bool) *Proxy {
+	var best *Proxy
+	for _, p := range candidates {
+		if p.Latency > 0 && (best == nil || p.Latency < best.Latency) {
+			best = p
+		}
+	}
+	if best == nil {
+		return pickWeighted(s, candidates, commit)
+	}
+	return best
+}
+
+// Pick the candidate with the fewest active checkouts, breaking ties randomly
+func pickLeastConn(_ *ProxyStore, candidates []*Proxy, commit bool) *Proxy {
+	var least []*Proxy
+	var min int64
+	for _, p := range candidates {
+		n := p.counters.active.Load()
+		switch {
+		case len(least) == 0 || n < min:
+			least, min = []*Proxy{p}, n
+		case n == min:
+			least = append(least, p)
+		}
+	}
+	return least[selectionIntn(len(least), commit)]
+}
+
+// Choose an available proxy accepted by the filters with pick, reporting
+// false if there is none. When commit is set the selection is counted and,
+// for a checkout, one of the proxy's connection slots is taken; otherwise
+// nothing changes. Callers must hold the lock.
+func (s *ProxyStore) choose(pick picker, checkout bool, filters []ProxyFilter, commit bool) (Proxy, bool) {
+	for {
+		candidates := s.available(filters)
+		if len(candidates) == 0 {
+			return Proxy{}, false
+		}
+
+		chosen := pick(s, candidates, commit)
+		if !commit {
+			return chosen.snapshot(), true
+		}
+		// A concurrent checkout may have taken the last slot since the scan
+		if checkout && !chosen.acquire() {
+			continue
+		}
+		return selected(chosen), true
+	}
+}
+
+// Select with pick under the read lock
+func (s *ProxyStore) selectWith(pick picker, checkout bool, filters []ProxyFilter) (Proxy, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.choose(pick, checkout, filters, true)
+}
+
+// Count a selection of p, claiming its breaker's trial if half-open, and
+// return its snapshot
+func selected(p *Proxy) Proxy {
+	now := time.Now()
+	p.counters.recordSelection(now)
+	p.breaker.selected(now)
+	return p.snapshot()
+}
+
+// Release hands back a proxy checked out by a selection and returns its
+// remaining active count. found is false if the proxy is not in the pool and
+// ok is false if it had no active checkouts.
+func (s *ProxyStore) Release(url string) (remaining int64, found, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.proxies {
+		if p.URL != url {
+			continue
+		}
+		for {
+			n := p.counters.active.Load()
+			if n == 0 {
+				return 0, true, false
+			}
+			if p.counters.active.CompareAndSwap(n, n-1) {
+				return n - 1, true, true
+			}
+		}
+	}
+	return 0, false, false
+}
+
+// ProxyStats is a proxy's selection history and current state
+type ProxyStats struct {
+	Proxy        string     `json:"proxy"`
+	Selections   uint64     `json:"selections"`
+	LastSelected *time.Time `json:"last_selected"`
+	Healthy      bool       `json:"healthy"`
+	FailCount    int        `json:"fail_count"`
+}
+
+// Stats returns the selection statistics of every proxy, with credentials masked
+func (s *ProxyStore) Stats() []ProxyStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]ProxyStats, len(s.proxies))
+	for i, p := range s.proxies {
+		out[i] = ProxyStats{
+			Proxy:      maskCredentials(p.URL),
+			Selections: p.counters.selections.Load(),
+			Healthy:    p.Healthy,
+			FailCount:  p.FailCount,
+		}
+		if ns := p.counters.lastSelected.Load(); ns != 0 {
+			t := time.Unix(0, ns).UTC()
+			out[i].LastSelected = &t
+		}
+	}
+	return out
+}
+
+// ResetStats zeroes every proxy's selection statistics
+func (s *ProxyStore) ResetStats() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.proxies {
+		p.counters.selections.Store(0)
+		p.counters.lastSelected.Store(0)
+	}
+}
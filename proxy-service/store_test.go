@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReportCooldownExpiry(t *testing.T) {
+	const url = "http://a.example.com:8080"
+	s := NewProxyStore([]string{url})
+	s.SetCooldownPolicy(CooldownPolicy{Threshold: 3, Duration: time.Minute})
+	// Keep the circuit breaker out of the way of the failure streaks
+	s.SetBreakerPolicy(BreakerPolicy{Threshold: 100, OpenTimeout: time.Minute, MaxOpenTimeout: time.Minute})
+	start := time.Now()
+
+	var p Proxy
+	for i := 0; i < 3; i++ {
+		p, _ = s.Report(url, false, start)
+	}
+	if !p.InCooldown(start) || !p.CooldownUntil.Equal(start.Add(time.Minute)) {
+		t.Fatalf("after 3 failures: cooldown until %v, want %v", p.CooldownUntil, start.Add(time.Minute))
+	}
+	if s.Available() != 0 {
+		t.Fatal("proxy in cooldown is still available")
+	}
+
+	// Failures during the cooldown do not extend it
+	p, _ = s.Report(url, false, start.Add(30*time.Second))
+	if !p.CooldownUntil.Equal(start.Add(time.Minute)) {
+		t.Fatalf("failure during cooldown moved it to %v", p.CooldownUntil)
+	}
+
+	// Once it has run out, a failure starts a fresh streak
+	expired := start.Add(2 * time.Minute)
+	p, _ = s.Report(url, false, expired)
+	if p.FailCount != 1 || !p.CooldownUntil.IsZero() {
+		t.Fatalf("first failure after expiry: fail_count %d, cooldown until %v; want 1 and none", p.FailCount, p.CooldownUntil)
+	}
+	s.Report(url, false, expired)
+	p, _ = s.Report(url, false, expired)
+	if !p.CooldownUntil.Equal(expired.Add(time.Minute)) {
+		t.Fatalf("third failure of the new streak: cooldown until %v, want %v", p.CooldownUntil, expired.Add(time.Minute))
+	}
+
+	// A success clears it early
+	p, _ = s.Report(url, true, expired)
+	if p.FailCount != 0 || !p.CooldownUntil.IsZero() {
+		t.Fatalf("after success: fail_count %d, cooldown until %v", p.FailCount, p.CooldownUntil)
+	}
+	if s.Available() != 1 {
+		t.Fatal("proxy is not available after a success")
+	}
+}
+
+// Meant to be run with -race as well
+func TestConcurrentCheckoutsRespectMaxConns(t *testing.T) {
+	const url = "http://a.example.com:8080"
+	const maxConns, workers, rounds = 3, 16, 200
+	s := NewProxyStore([]string{url})
+	s.proxies[0].MaxConns = maxConns
+
+	var peak, held atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				p, err := s.SelectProxy(strategyLeastConn)
+				if errors.Is(err, errNoProxyAvailable) {
+					continue
+				}
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n := held.Add(1)
+				for {
+					m := peak.Load()
+					if n <= m || peak.CompareAndSwap(m, n) {
+						break
+					}
+				}
+				held.Add(-1)
+				if _, found, ok := s.Release(p.URL); !found || !ok {
+					t.Errorf("Release(%s) = found %v, ok %v", p.URL, found, ok)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if m := peak.Load(); m > maxConns {
+		t.Errorf("%d checkouts held at once, limit is %d", m, maxConns)
+	}
+	if n := s.proxies[0].counters.active.Load(); n != 0 {
+		t.Errorf("active checkouts after every release = %d, want 0", n)
+	}
+	if _, _, ok := s.Release(url); ok {
+		t.Error("Release succeeded with no checkout outstanding")
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Selection strategies accepted by SelectProxy
+const (
+	// Uniformly random, ignoring weights
+	strategyRandom = "random"
+	// Random in proportion to weight
+	strategyWeighted   = "weighted"
+	strategyRoundRobin = "round-robin"
+	// Checks the proxy out until it is released
+	strategyLeastConn = "least-conn"
+	strategyFastest   = "fastest"
+)
+
+// Strategy used by GET /proxy without ?strategy=, set from SELECTION_STRATEGY
+var defaultStrategy = strategyWeighted
+
+// Strategy names in the order they are listed to clients
+var strategyNames = []string{strategyRandom, strategyWeighted, strategyRoundRobin, strategyLeastConn, strategyFastest}
+
+// Errors returned by SelectProxy
+var (
+	errUnknownStrategy  = errors.New("unknown selection strategy")
+	errNoProxyAvailable = errors.New("no proxy available")
+)
+
+// How a strategy picks among the available proxies, and whether a selection
+// checks the proxy out until it is released
+type strategyDef struct {
+	pick     picker
+	checkout bool
+}
+
+// Strategies by name
+var strategies = map[string]strategyDef{
+	strategyRandom:     {pick: pickUniform},
+	strategyWeighted:   {pick: pickWeighted},
+	strategyRoundRobin: {pick: pickRoundRobin},
+	strategyLeastConn:  {pick: pickLeastConn, checkout: true},
+	strategyFastest:    {pick: pickFastest},
+}
+
+// Look up a strategy by name
+func lookupStrategy(name string) (strategyDef, error) {
+	def, ok := strategies[name]
+	if !ok {
+		return strategyDef{}, fmt.Errorf("%w %q, expected one of %s", errUnknownStrategy, name, strings.Join(strategyNames, ", "))
+	}
+	return def, nil
+}
+
+// ValidStrategy reports whether name is a selection strategy
+func ValidStrategy(name string) bool {
+	_, ok := strategies[name]
+	return ok
+}
+
+// Whether the named strategy checks out the proxies it selects
+func checksOut(strategy string) bool {
+	return strategies[strategy].checkout
+}
+
+// SelectProxy picks an available proxy accepted by the filters using the
+// named strategy. It returns an error wrapping errUnknownStrategy for an
+// unknown name and errNoProxyAvailable when nothing can be handed out.
+func (s *ProxyStore) SelectProxy(strategy string, filters ...ProxyFilter) (*Proxy, error) {
+	def, err := lookupStrategy(strategy)
+	if err != nil {
+		return nil, err
+	}
+	proxy, ok := s.selectWith(def.pick, def.checkout, filters)
+	if !ok {
+		return nil, errNoProxyAvailable
+	}
+	return &proxy, nil
+}
+
+// Checkout is SelectProxy that always takes one of the chosen proxy's
+// connection slots, whatever the strategy, so proxies at max_conns are passed
+// over. The caller must hand the proxy back with Release.
+func (s *ProxyStore) Checkout(strategy string, filters ...ProxyFilter) (*Proxy, error) {
+	def, err := lookupStrategy(strategy)
+	if err != nil {
+		return nil, err
+	}
+	proxy, ok := s.selectWith(def.pick, true, filters)
+	if !ok {
+		return nil, errNoProxyAvailable
+	}
+	return &proxy, nil
+}
+
+// Preferred selects with the strategy among the first of the schemes that
+// has an available proxy accepted by the filters. When none of them has one
+// it selects from any scheme, so it only fails if SelectProxy would.
+func (s *ProxyStore) Preferred(strategy string, schemes []string, filters ...ProxyFilter) (*Proxy, error) {
+	for _, set := range preferenceFilters(schemes, filters) {
+		proxy, err := s.SelectProxy(strategy, set...)
+		if !errors.Is(err, errNoProxyAvailable) {
+			return proxy, err
+		}
+	}
+	return nil, errNoProxyAvailable
+}
+
+// Filter sets to try in order when preferring schemes: the filters narrowed
+// to each scheme, then the filters alone
+func preferenceFilters(schemes []string, filters []ProxyFilter) [][]ProxyFilter {
+	sets := make([][]ProxyFilter, 0, len(schemes)+1)
+	for _, scheme := range schemes {
+		// Full slice expression so the sets never share a backing array
+		sets = append(sets, append(filters[:len(filters):len(filters)], SchemeFilter(scheme)))
+	}
+	return append(sets, filters)
+}
+
+// Exclusion is a proxy accepted by the filters that could not be selected
+type Exclusion struct {
+	Proxy  string `json:"proxy"`
+	Reason string `json:"reason"`
+}
+
+// Preview describes what a selection would return without making it
+type Preview struct {
+	Strategy string
+	// The proxy that would be chosen, nil if none is available. Random
+	// strategies draw afresh on every call, so this is one possible outcome.
+	Proxy *Proxy
+	// Proxies in the pool, and how many of them the filters accept
+	Pool, Matched int
+	// Accepted proxies that can be handed out right now
+	Available int
+	// Accepted proxies that cannot, in pool order
+	Excluded []Exclusion
+}
+
+// PreviewProxy runs the named strategy's selection over the proxies accepted
+// by the filters without recording it: selection counts, checkouts, breaker
+// trials, the round-robin cursor and the seeded selection RNG are left as
+// they are; random picks come from a separate generator. Excluded proxies
+// are listed with their unmasked URLs. It fails only for an unknown strategy.
+func (s *ProxyStore) PreviewProxy(strategy string, filters ...ProxyFilter) (Preview, error) {
+	def, err := lookupStrategy(strategy)
+	if err != nil {
+		return Preview{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	preview := Preview{Strategy: strategy, Pool: len(s.proxies), Excluded: []Exclusion{}}
+	if proxy, ok := s.choose(def.pick, def.checkout, filters, false); ok {
+		preview.Proxy = &proxy
+	}
+	now := time.Now()
+	for _, p := range s.proxies {
+		if !matchAll(p, filters) {
+			continue
+		}
+		preview.Matched++
+		if reason := p.unavailableReason(now); reason != "" {
+			preview.Excluded = append(preview.Excluded, Exclusion{Proxy: p.URL, Reason: reason})
+		} else {
+			preview.Available++
+		}
+	}
+	return preview, nil
+}
+
+// PreviewPreferred previews Preferred: the first filter set with an
+// available proxy, or the filters alone when none has one
+func (s *ProxyStore) PreviewPreferred(strategy string, schemes []string, filters ...ProxyFilter) (Preview, error) {
+	var preview Preview
+	var err error
+	for _, set := range preferenceFilters(schemes, filters) {
+		preview, err = s.PreviewProxy(strategy, set...)
+		if err != nil || preview.Proxy != nil {
+			break
+		}
+	}
+	return preview, err
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Ask the router for a proxy at target and return its (masked) URL
+func selectVia(t *testing.T, h http.Handler, target string) string {
+	t.Helper()
+
+	w := serve(h, http.MethodGet, target, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d, body %s", target, w.Code, w.Body)
+	}
+	var body struct {
+		Proxy string `json:"proxy"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body.Proxy
+}
+
+func TestNextCyclesThroughEveryProxy(t *testing.T) {
+	urls := []string{
+		"http://a.example.com:8080",
+		"http://b.example.com:8080",
+		"http://c.example.com:8080",
+		"socks5://d.example.com:1081",
+	}
+	useStore(t, urls...)
+	router := testRouter(t, routerConfig{})
+
+	counts := make(map[string]int)
+	var order []string
+	for i := 0; i < 2*len(urls); i++ {
+		p := selectVia(t, router, "/proxy/next")
+		counts[p]++
+		order = append(order, p)
+	}
+
+	if len(counts) != len(urls) {
+		t.Fatalf("got %d distinct proxies, want %d: %v", len(counts), len(urls), counts)
+	}
+	for p, n := range counts {
+		if n != 2 {
+			t.Errorf("%s returned %d times, want 2", p, n)
+		}
+	}
+	for i := range urls {
+		if order[i] != order[i+len(urls)] {
+			t.Errorf("position %d: first pass %s, second pass %s", i, order[i], order[i+len(urls)])
+		}
+	}
+}
+
+func TestFastestPrefersLowestLatency(t *testing.T) {
+	s := useStore(t, "http://slow.example.com:8080", "http://fast.example.com:8080", "http://medium.example.com:8080", "http://unmeasured.example.com:8080")
+	now := time.Now()
+	s.SetHealth("http://slow.example.com:8080", true, 300*time.Millisecond, now)
+	s.SetHealth("http://fast.example.com:8080", true, 20*time.Millisecond, now)
+	s.SetHealth("http://medium.example.com:8080", true, 80*time.Millisecond, now)
+	router := testRouter(t, routerConfig{})
+
+	for _, want := range []string{"http://fast.example.com:8080", "http://medium.example.com:8080", "http://slow.example.com:8080"} {
+		for i := 0; i < 3; i++ {
+			if got := selectVia(t, router, "/proxy/fastest"); got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		}
+		// Take the winner out so the next one up must be chosen
+		s.SetHealth(want, false, 0, now)
+	}
+}
+
+func TestPickFastestFallsBackWithoutMeasurements(t *testing.T) {
+	s := useStore(t, "http://a.example.com:8080", "http://b.example.com:8080")
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if p := pickFastest(s, s.proxies, false); p == nil {
+		t.Fatal("pickFastest returned nil for unmeasured candidates")
+	}
+}
+
+func TestPickWeightedFollowsWeights(t *testing.T) {
+	seedRNG(1)
+	t.Cleanup(func() { seedRNG(time.Now().UnixNano()) })
+
+	weights := map[string]int{
+		"http://a.example.com:8080": 1,
+		"http://b.example.com:8080": 2,
+		"http://c.example.com:8080": 7,
+	}
+	var candidates []*Proxy
+	total := 0
+	for url, w := range weights {
+		candidates = append(candidates, newProxy(Proxy{URL: url, Weight: w}))
+		total += w
+	}
+
+	const draws = 100000
+	counts := make(map[string]int)
+	for i := 0; i < draws; i++ {
+		counts[pickWeighted(nil, candidates, true).URL]++
+	}
+	for url, w := range weights {
+		want := float64(w) / float64(total)
+		got := float64(counts[url]) / draws
+		if diff := got - want; diff > 0.01 || diff < -0.01 {
+			t.Errorf("%s (weight %d): picked %.3f of the time, want %.3f ± 0.01", url, w, got, want)
+		}
+	}
+}
+
+// Run by TestSelectionSeedIsReproducible in a fresh test binary: seed the
+// selection RNG from SELECTION_SEED as main does and print 50 picks
+func TestSelectionSeedHelper(t *testing.T) {
+	if os.Getenv("SELECTION_SEED_HELPER") != "1" {
+		t.Skip("only run by TestSelectionSeedIsReproducible")
+	}
+	if _, ok, err := seedFromEnv(); !ok || err != nil {
+		t.Fatalf("SELECTION_SEED not applied: %v", err)
+	}
+	s := NewProxyStore([]string{
+		"http://a.example.com:8080",
+		"http://b.example.com:8080",
+		"http://c.example.com:8080",
+		"http://d.example.com:8080",
+		"http://e.example.com:8080",
+	})
+	s.proxies[1].Weight = 3
+	for _, strategy := range []string{strategyWeighted, strategyRandom, strategyWeighted, strategyLeastConn, strategyRandom} {
+		for i := 0; i < 10; i++ {
+			p, err := s.SelectProxy(strategy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fmt.Println("pick", p.URL)
+		}
+	}
+}
+
+func TestSelectionSeedIsReproducible(t *testing.T) {
+	run := func(seed string) []string {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestSelectionSeedHelper$", "-test.v")
+		cmd.Env = append(os.Environ(), "SELECTION_SEED_HELPER=1", "SELECTION_SEED="+seed)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("seed %s: %v\n%s", seed, err, out)
+		}
+		var picks []string
+		for _, line := range strings.Split(string(out), "\n") {
+			if url, ok := strings.CutPrefix(line, "pick "); ok {
+				picks = append(picks, url)
+			}
+		}
+		if len(picks) != 50 {
+			t.Fatalf("seed %s: %d picks, want 50\n%s", seed, len(picks), out)
+		}
+		return picks
+	}
+
+	first, second := run("7"), run("7")
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("pick %d differs between runs with the same seed: %s then %s", i, first[i], second[i])
+		}
+	}
+	other := run("8")
+	same := true
+	for i := range first {
+		same = same && first[i] == other[i]
+	}
+	if same {
+		t.Error("a different seed gave the same 50 picks")
+	}
+}
+
+func TestPreviewLeavesSelectionSequenceAlone(t *testing.T) {
+	t.Cleanup(func() { seedRNG(time.Now().UnixNano()) })
+	urls := []string{
+		"http://a.example.com:8080",
+		"http://b.example.com:8080",
+		"http://c.example.com:8080",
+		"http://d.example.com:8080",
+	}
+
+	run := func(preview bool) []string {
+		s := NewProxyStore(urls)
+		seedRNG(3)
+		var picks []string
+		for _, strategy := range []string{strategyWeighted, strategyRandom, strategyLeastConn} {
+			for i := 0; i < 10; i++ {
+				if preview {
+					if _, err := s.PreviewProxy(strategy); err != nil {
+						t.Fatal(err)
+					}
+				}
+				p, err := s.SelectProxy(strategy)
+				if err != nil {
+					t.Fatal(err)
+				}
+				picks = append(picks, p.URL)
+			}
+		}
+		return picks
+	}
+
+	want, got := run(false), run(true)
+	for i := range want {
+		if want[i] != got[i] {
+			t.Fatalf("pick %d changed by interleaved previews: %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestPreferredFallsThroughSchemes(t *testing.T) {
+	s := useStore(t, "http://a.example.com:8080", "socks5://b.example.com:1080", "https://c.example.com:8443")
+	socks, https := s.proxies[1], s.proxies[2]
+
+	tests := []struct {
+		name    string
+		schemes []string
+		filters []ProxyFilter
+		setup   func()
+		want    string
+	}{
+		{"first preference available", []string{"socks5", "https"}, nil, func() {}, socks.URL},
+		{"first preference unhealthy", []string{"socks5", "https"}, nil, func() { socks.Healthy = false }, https.URL},
+		{"no preference available", []string{"socks5"}, []ProxyFilter{URLFilter(https.URL)}, func() { socks.Healthy = false }, https.URL},
+		{"preference with no proxies", []string{"ftp"}, []ProxyFilter{SchemeFilter("https")}, func() {}, https.URL},
+	}
+	for _, tt := range tests {
+		socks.Healthy = true
+		tt.setup()
+		p, err := s.Preferred(strategyRoundRobin, tt.schemes, tt.filters...)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if p.URL != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, p.URL, tt.want)
+		}
+	}
+
+	for _, p := range s.proxies {
+		p.Healthy = false
+	}
+	if _, err := s.Preferred(strategyRoundRobin, []string{"socks5", "https"}); !errors.Is(err, errNoProxyAvailable) {
+		t.Errorf("Preferred with nothing available = %v, want errNoProxyAvailable", err)
+	}
+	if _, err := s.Preferred("bogus", []string{"socks5"}); !errors.Is(err, errUnknownStrategy) {
+		t.Errorf("Preferred with an unknown strategy = %v, want errUnknownStrategy", err)
+	}
+}
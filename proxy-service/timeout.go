@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware giving each request a deadline. Handlers must pass
+// c.Request.Context() to outbound calls so they are cancelled when it passes;
+// a handler that runs out of time without writing a response gets 504, sent
+// once it returns.
+func timeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Writer.Written() {
+			respondError(c, http.StatusGatewayTimeout, errTimeout, "Request timed out")
+		}
+	}
+}
+
+// Whether the request's deadline has passed, in which case the handler should
+// return without responding and leave the 504 to timeoutMiddleware
+func timedOut(c *gin.Context) bool {
+	return errors.Is(c.Request.Context().Err(), context.DeadlineExceeded)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTimeoutAnswersSlowHandlerWith504(t *testing.T) {
+	const deadline, work = 20 * time.Millisecond, 100 * time.Millisecond
+	router := gin.New()
+	router.Use(timeoutMiddleware(deadline))
+	router.GET("/slow", func(c *gin.Context) {
+		// Ignores the deadline, as a handler blocked on a call without the
+		// request context would
+		time.Sleep(work)
+	})
+	router.GET("/fast", func(c *gin.Context) {
+		c.String(http.StatusOK, "done")
+	})
+
+	start := time.Now()
+	w := serve(router, http.MethodGet, "/slow", "")
+	elapsed := time.Since(start)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("slow handler = %d, want 504", w.Code)
+	}
+	var body struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error.Code != errTimeout {
+		t.Errorf("body = %s, want the %s error", w.Body, errTimeout)
+	}
+	if elapsed < work {
+		t.Errorf("504 sent after %v, before the handler returned", elapsed)
+	}
+
+	if w := serve(router, http.MethodGet, "/fast", ""); w.Code != http.StatusOK || w.Body.String() != "done" {
+		t.Errorf("fast handler = %d %s, want 200 done", w.Code, w.Body)
+	}
+}
+
+func TestTimeoutKeepsLateResponse(t *testing.T) {
+	router := gin.New()
+	router.Use(timeoutMiddleware(10 * time.Millisecond))
+	router.GET("/late", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		c.String(http.StatusAccepted, "late")
+	})
+
+	if w := serve(router, http.MethodGet, "/late", ""); w.Code != http.StatusAccepted || w.Body.String() != "late" {
+		t.Errorf("late handler = %d %s, want its own response kept", w.Code, w.Body)
+	}
+}
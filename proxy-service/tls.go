@@ -0,0 +1,49 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Values accepted by TLS_MIN_VERSION
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Build the server's TLS configuration from TLS_CERT_FILE, TLS_KEY_FILE and
+// TLS_MIN_VERSION (default 1.2). It returns nil when neither file is set, so
+// the server runs plain HTTP, and an error when only one is set or the pair
+// cannot be loaded.
+func tlsConfigFromEnv() (*tls.Config, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	switch {
+	case certFile == "" && keyFile == "":
+		return nil, nil
+	case certFile == "":
+		return nil, errors.New("TLS_KEY_FILE is set but TLS_CERT_FILE is not")
+	case keyFile == "":
+		return nil, errors.New("TLS_CERT_FILE is set but TLS_KEY_FILE is not")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+
+	var minVersion uint16 = tls.VersionTLS12
+	if v := os.Getenv("TLS_MIN_VERSION"); v != "" {
+		version, ok := tlsVersions[v]
+		if !ok {
+			return nil, fmt.Errorf("TLS_MIN_VERSION: unsupported %q, expected 1.2 or 1.3", v)
+		}
+		minVersion = version
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}, nil
+}
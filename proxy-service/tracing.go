@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name reported as the service and the instrumentation scope
+const serviceName = "proxy-service"
+
+// Tracer for the service's own spans. It is a no-op until setupTracing
+// installs an exporting provider.
+var tracer = otel.Tracer(serviceName)
+
+// Install W3C trace context propagation and, when OTEL_EXPORTER_OTLP_ENDPOINT
+// is set, a provider exporting spans over OTLP/HTTP. The exporter reads the
+// standard OTEL_EXPORTER_OTLP_* variables itself. The returned function
+// flushes and stops the exporter.
+func setupTracing(ctx context.Context) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the default name
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Middleware starting a span per request, continuing the trace from an
+// incoming traceparent header. Probes and /metrics are not traced.
+func tracingMiddleware(skip ...string) gin.HandlerFunc {
+	skipped := make(map[string]bool, len(skip))
+	for _, path := range skip {
+		skipped[path] = true
+	}
+
+	return otelgin.Middleware(serviceName, otelgin.WithFilter(func(r *http.Request) bool {
+		return !skipped[r.URL.Path]
+	}))
+}
+
+// Start a child span of the request's span covering a proxy selection
+func startSelectionSpan(c *gin.Context, strategy string) trace.Span {
+	_, span := tracer.Start(c.Request.Context(), "proxy.select",
+		trace.WithAttributes(attribute.String("proxy.strategy", strategy)))
+	return span
+}
+
+// Record the selected proxy, without credentials, and end the span
+func endSelectionSpan(span trace.Span, proxy *Proxy, ok bool) {
+	if ok {
+		span.SetAttributes(attribute.String("proxy.url", maskCredentials(proxy.URL)))
+	} else {
+		span.SetStatus(codes.Error, "no proxy available")
+	}
+	span.End()
+}
+
+// Start a span for an outbound call through a proxy, named after the operation
+func startProxySpan(ctx context.Context, name, proxyURL string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("proxy.url", maskCredentials(proxyURL))))
+}
+
+// Mark the span failed if err is set, then end it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,59 @@
+package main
+
+// Health checks a proxy's uptime is computed over, set from UPTIME_WINDOW
+// at startup
+var uptimeWindow = 20
+
+// Whether ?minUptime= leaves out proxies that have not yet had uptimeWindow
+// checks, set from UPTIME_EXCLUDE_NEW; by default they count as fully up
+var uptimeExcludeNew = false
+
+// Ring buffer of a proxy's most recent health check outcomes. It is guarded
+// by the store's lock like the rest of the proxy.
+type checkHistory struct {
+	results []bool
+	// Slot the next outcome is written to
+	next int
+	// Slots filled so far, at most len(results)
+	count int
+	// Filled slots holding a success
+	up int
+}
+
+// Create a history keeping the last size outcomes
+func newCheckHistory(size int) *checkHistory {
+	return &checkHistory{results: make([]bool, size)}
+}
+
+// Add an outcome, overwriting the oldest once the buffer is full
+func (h *checkHistory) record(ok bool) {
+	if len(h.results) == 0 {
+		return
+	}
+	if h.count == len(h.results) {
+		if h.results[h.next] {
+			h.up--
+		}
+	} else {
+		h.count++
+	}
+	h.results[h.next] = ok
+	if ok {
+		h.up++
+	}
+	h.next = (h.next + 1) % len(h.results)
+}
+
+// Percentage of the recorded outcomes that were successes, and how many
+// outcomes that is based on; 0 and 0 before the first check
+func (h *checkHistory) uptime() (float64, int) {
+	if h.count == 0 {
+		return 0, 0
+	}
+	return 100 * float64(h.up) / float64(h.count), h.count
+}
+
+// Whether the window has been filled
+func (h *checkHistory) full() bool {
+	return h.count == len(h.results)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckHistoryRollsOver(t *testing.T) {
+	h := newCheckHistory(4)
+	if uptime, n := h.uptime(); uptime != 0 || n != 0 {
+		t.Fatalf("empty history uptime = %v over %d, want 0 over 0", uptime, n)
+	}
+
+	steps := []struct {
+		ok     bool
+		uptime float64
+		checks int
+	}{
+		{true, 100, 1},
+		{false, 50, 2},
+		{true, 100 * 2 / 3.0, 3},
+		{true, 75, 4},
+		// Full from here on: each outcome replaces the oldest
+		{false, 50, 4}, // drops a success
+		{true, 75, 4},  // drops the failure
+		{false, 50, 4}, // drops a success
+		{false, 25, 4}, // drops a success
+		{false, 25, 4}, // drops a failure
+		{false, 0, 4},  // drops the last success
+		{true, 25, 4},  // drops a failure
+	}
+	for i, step := range steps {
+		h.record(step.ok)
+		uptime, n := h.uptime()
+		if uptime != step.uptime || n != step.checks {
+			t.Fatalf("after outcome %d uptime = %v over %d, want %v over %d", i+1, uptime, n, step.uptime, step.checks)
+		}
+		if full := i >= 3; h.full() != full {
+			t.Fatalf("after outcome %d full = %v, want %v", i+1, h.full(), full)
+		}
+	}
+}
+
+func TestCheckHistoryWithoutWindow(t *testing.T) {
+	h := newCheckHistory(0)
+	h.record(true)
+	if uptime, n := h.uptime(); uptime != 0 || n != 0 {
+		t.Errorf("zero-size history uptime = %v over %d, want nothing recorded", uptime, n)
+	}
+}
+
+func TestUptimeFilter(t *testing.T) {
+	newProxyWith := func(outcomes ...bool) *Proxy {
+		p := &Proxy{history: newCheckHistory(4)}
+		for _, ok := range outcomes {
+			p.history.record(ok)
+		}
+		return p
+	}
+	fresh := newProxyWith(false, false)
+	flaky := newProxyWith(true, false, false, true)
+	steady := newProxyWith(true, true, true, false)
+
+	for _, tc := range []struct {
+		p          *Proxy
+		excludeNew bool
+		want       bool
+	}{
+		{fresh, false, true},
+		{fresh, true, false},
+		{flaky, false, false},
+		{steady, false, true},
+		{steady, true, true},
+	} {
+		if got := UptimeFilter(75, tc.excludeNew)(tc.p); got != tc.want {
+			uptime, n := tc.p.history.uptime()
+			t.Errorf("UptimeFilter(75, %v) on %v%% over %d checks = %v, want %v", tc.excludeNew, uptime, n, got, tc.want)
+		}
+	}
+}
+
+func TestSetHealthRecordsUptime(t *testing.T) {
+	const url = "http://a.example.com:8080"
+	s := NewProxyStore([]string{url})
+	for _, ok := range []bool{true, false, true, true} {
+		s.SetHealth(url, ok, 0, time.Now())
+	}
+	p := s.List()[0]
+	if p.Uptime != 75 || p.UptimeChecks != 4 {
+		t.Errorf("snapshot uptime = %v over %d, want 75 over 4", p.Uptime, p.UptimeChecks)
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Schemes a proxy URL may use
+var allowedSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"socks5": true,
+}
+
+// Scheme assumed for proxies given as bare host:port, set from
+// DEFAULT_PROXY_SCHEME
+var defaultScheme = "http"
+
+// Prefix raw with the default scheme if it has none. Without "://" url.Parse
+// would read "host:port" as a scheme and opaque path.
+func withScheme(raw string) string {
+	if strings.Contains(raw, "://") {
+		return raw
+	}
+	return defaultScheme + "://" + raw
+}
+
+// ValidateProxy checks that raw is a usable proxy URL with a supported
+// scheme, a host and a valid port, which may be left out for the scheme's
+// default. A bare host:port is taken to use the default scheme.
+func ValidateProxy(raw string) error {
+	u, err := url.Parse(withScheme(strings.TrimSpace(raw)))
+	if err != nil {
+		return fmt.Errorf("proxy: %v", err)
+	}
+	if !allowedSchemes[strings.ToLower(u.Scheme)] {
+		return fmt.Errorf("scheme: unsupported %q, expected one of http, https, socks5", u.Scheme)
+	}
+
+	if u.Hostname() == "" {
+		return fmt.Errorf("host: missing")
+	}
+
+	// NormalizeProxy drops default ports, so its output must still pass
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("port: invalid %q", port)
+	}
+
+	if u.User != nil && u.User.Username() == "" {
+		return fmt.Errorf("credentials: missing username")
+	}
+
+	return nil
+}
+
+// NormalizeProxy returns the canonical form of a proxy URL: lowercase scheme
+// and host, no port when it is the scheme's default, and no trailing slash.
+// A bare host:port gets the default scheme. Credentials are kept as given.
+func NormalizeProxy(raw string) (string, error) {
+	u, err := url.Parse(withScheme(strings.TrimSpace(raw)))
+	if err != nil {
+		return "", fmt.Errorf("proxy: %v", err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	switch {
+	case port != "":
+		u.Host = net.JoinHostPort(host, port)
+	case strings.Contains(host, ":"):
+		u.Host = "[" + host + "]"
+	default:
+		u.Host = host
+	}
+
+	if u.Path == "/" {
+		u.Path = ""
+	}
+	return u.String(), nil
+}
+
+// Normalize a list of proxies, dropping duplicates and, with a warning,
+// entries that ValidateProxy rejects
+func dedupeProxies(raw []string) []string {
+	seen := make(map[string]bool, len(raw))
+	var out []string
+	for _, r := range raw {
+		err := ValidateProxy(r)
+		var n string
+		if err == nil {
+			n, err = NormalizeProxy(r)
+		}
+		if err != nil {
+			slog.Warn("Skipping invalid proxy", "proxy", maskCredentials(r), "error", err)
+			continue
+		}
+		if seen[n] {
+			continue
+		}
+		seen[n] = true
+		out = append(out, n)
+	}
+	return out
+}
+
+// Mask the username and password of a proxy URL as ***:***, leaving proxies
+// without credentials unchanged
+func maskCredentials(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+
+	if _, hasPassword := u.User.Password(); hasPassword {
+		u.User = url.UserPassword("***", "***")
+	} else {
+		u.User = url.User("***")
+	}
+	// url.URL escapes "*" in userinfo, so put the placeholders back
+	return strings.Replace(u.String(), "%2A%2A%2A", "***", 2)
+}
+
+// Whether raw is an absolute http or https URL, as required of request targets
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Trim tags and drop empty and repeated ones
+func cleanTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	out := []string{}
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
+// Uppercase a country code and check it is two ASCII letters
+func normalizeCountry(raw string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(raw))
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return "", fmt.Errorf("country: %q is not a two-letter ISO code", raw)
+	}
+	return code, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build information, set at build time with
+//
+//	go build -ldflags "-X main.version=v1.2.3 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// Describe the running build
+func buildInfo() gin.H {
+	return gin.H{
+		"version":    version,
+		"commit":     commit,
+		"build_time": buildTime,
+		"go_version": runtime.Version(),
+	}
+}
+
+// Report which build is running
+func GetVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, buildInfo())
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Types of webhook event
+const (
+	// A health check failed for a proxy that was healthy
+	eventProxyUnhealthy = "proxy_unhealthy"
+	// A proxy was removed after too many failures
+	eventProxyEvicted = "proxy_evicted"
+	// The number of healthy proxies fell below the configured threshold
+	eventPoolDegraded = "pool_degraded"
+)
+
+// Event is the JSON body posted to the webhook
+type Event struct {
+	Type string `json:"type"`
+	// Proxy the event is about, with credentials masked; empty for pool events
+	Proxy     string    `json:"proxy,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// Pool counts after the change
+	Healthy int `json:"healthy"`
+	Total   int `json:"total"`
+	// Healthy count pool_degraded fired below
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// Events waiting for delivery beyond this are dropped
+const webhookQueueSize = 100
+
+// Deadline for each webhook request
+const webhookTimeout = 5 * time.Second
+
+// How often and how far apart a failed webhook delivery is retried
+var webhookRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Second,
+	MaxDelay:    10 * time.Second,
+}
+
+// Notifier posts pool events to a webhook. Events are queued and delivered
+// one at a time by Run, so reporting one never waits on the network. A nil
+// Notifier drops every event.
+type Notifier struct {
+	url    string
+	client *http.Client
+	events chan Event
+
+	// Healthy count below which pool_degraded fires, zero to never fire it
+	threshold int
+	// Whether the pool is below the threshold, so the event fires once per drop
+	degraded atomic.Bool
+}
+
+// NewNotifier creates a notifier posting to url, firing pool_degraded when
+// fewer than threshold proxies are healthy
+func NewNotifier(url string, threshold int) *Notifier {
+	return &Notifier{
+		url:       url,
+		client:    &http.Client{Timeout: webhookTimeout},
+		events:    make(chan Event, webhookQueueSize),
+		threshold: threshold,
+	}
+}
+
+// Notify queues an event for delivery, dropping it if the queue is full
+func (n *Notifier) Notify(e Event) {
+	if n == nil {
+		return
+	}
+	select {
+	case n.events <- e:
+	default:
+		slog.Warn("Webhook queue full, dropping event", "type", e.Type, "proxy", e.Proxy)
+	}
+}
+
+// Queue pool_degraded if the healthy count has just fallen below the
+// threshold, and rearm it once the count is back up
+func (n *Notifier) observeHealthy(healthy, total int, now time.Time) {
+	if n == nil || n.threshold == 0 {
+		return
+	}
+	if healthy >= n.threshold {
+		n.degraded.Store(false)
+		return
+	}
+	if n.degraded.CompareAndSwap(false, true) {
+		n.Notify(Event{Type: eventPoolDegraded, Timestamp: now, Healthy: healthy, Total: total, Threshold: n.threshold})
+	}
+}
+
+// Run delivers queued events until ctx is done; events still queued then are
+// dropped
+func (n *Notifier) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-n.events:
+			n.deliver(ctx, e)
+		}
+	}
+}
+
+// Post the event, retrying per webhookRetryPolicy
+func (n *Notifier) deliver(ctx context.Context, e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("Failed to encode webhook event", "type", e.Type, "error", err)
+		return
+	}
+
+	attempts, err := retry(ctx, webhookRetryPolicy, func(int) error {
+		return n.post(ctx, body)
+	})
+	if err != nil {
+		slog.Warn("Webhook delivery failed", "type", e.Type, "attempts", attempts, "error", err)
+	}
+}
+
+// Make one webhook request. Client errors other than 429 are not retried,
+// since sending the same body again will not fix them.
+func (n *Notifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return stopRetry(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainBytes))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests:
+		return stopRetry(fmt.Errorf("webhook responded %d", resp.StatusCode))
+	default:
+		return fmt.Errorf("webhook responded %d", resp.StatusCode)
+	}
+}